@@ -0,0 +1,210 @@
+package bptree
+
+import (
+	"cmp"
+	"fmt"
+)
+
+// Aggregate summarises records as a value of type A, for trees created with WithAggregate
+// Combine has to be associative, with Identity as the summary of no records at all
+// Summaries are always combined in key order, so Combine does not have to be commutative
+type Aggregate[T cmp.Ordered, A any] struct {
+	Identity A
+	// the summary of a single record
+	Of      func(record Record[T]) A
+	Combine func(left A, right A) A
+}
+
+// the aggregate with its summary type left out, so that the tree can hold it
+type aggregator[T cmp.Ordered] interface {
+	identity() any
+	of(record Record[T]) any
+	combine(left any, right any) any
+}
+
+func (a Aggregate[T, A]) identity() any {
+	return a.Identity
+}
+
+func (a Aggregate[T, A]) of(record Record[T]) any {
+	return a.Of(record)
+}
+
+func (a Aggregate[T, A]) combine(left any, right any) any {
+	return a.Combine(left.(A), right.(A))
+}
+
+// WithAggregate has every node keep the summary of the records under it, so that AggregateRange can summarise a range in O(log n)
+func WithAggregate[T cmp.Ordered, A any](aggregate Aggregate[T, A]) TreeOption {
+	return func(o *treeOptions) {
+		o.aggregate = aggregate
+	}
+}
+
+// SumOf adds up the value of each record
+func SumOf[T cmp.Ordered, N cmp.Ordered](value func(record Record[T]) N) Aggregate[T, N] {
+	return Aggregate[T, N]{
+		Of: value,
+		Combine: func(left N, right N) N {
+			return left + right
+		},
+	}
+}
+
+// Extremum is the summary MinOf and MaxOf keep, where OK is false if there were no records
+type Extremum[N cmp.Ordered] struct {
+	Value N
+	OK    bool
+}
+
+// MinOf keeps the smallest value of any record
+func MinOf[T cmp.Ordered, N cmp.Ordered](value func(record Record[T]) N) Aggregate[T, Extremum[N]] {
+	return extremumOf(value, func(left N, right N) N {
+		return min(left, right)
+	})
+}
+
+// MaxOf keeps the largest value of any record
+func MaxOf[T cmp.Ordered, N cmp.Ordered](value func(record Record[T]) N) Aggregate[T, Extremum[N]] {
+	return extremumOf(value, func(left N, right N) N {
+		return max(left, right)
+	})
+}
+
+func extremumOf[T cmp.Ordered, N cmp.Ordered](value func(record Record[T]) N, pick func(N, N) N) Aggregate[T, Extremum[N]] {
+	return Aggregate[T, Extremum[N]]{
+		Of: func(record Record[T]) Extremum[N] {
+			return Extremum[N]{Value: value(record), OK: true}
+		},
+		Combine: func(left Extremum[N], right Extremum[N]) Extremum[N] {
+			if !left.OK {
+				return right
+			}
+			if !right.OK {
+				return left
+			}
+			return Extremum[N]{Value: pick(left.Value, right.Value), OK: true}
+		},
+	}
+}
+
+// AggregateRange returns the summary of the records that satisfy low <= x < high, on a tree created with WithAggregate
+// A has to be the summary type of the tree's aggregate
+func AggregateRange[A any, T cmp.Ordered](t *Tree[T], low T, high T) (A, error) {
+	return AggregateKeys[A](t, halfOpen(low, high))
+}
+
+// AggregateKeys returns the summary of the records with a key in the range, on a tree created with WithAggregate
+// It returns ErrUnsupported on a tree without an aggregate, or if A is not the summary type of the tree's aggregate
+func AggregateKeys[A any, T cmp.Ordered](t *Tree[T], keys KeyRange[T]) (result A, err error) {
+	if t.aggregate == nil {
+		return result, fmt.Errorf("%w: only trees created with WithAggregate can aggregate records", ErrUnsupported)
+	}
+	defer t.catchCorrupt(&err)
+
+	// writers to a tree with aggregates hold the whole tree, so the summaries can be read without latching the nodes
+	_, unlock := t.lockTree(latchRead)
+	defer unlock()
+
+	summary := t.aggregate.identity()
+	if t.root != nil {
+		summary = t.aggregateUnder(t.root, keys)
+	}
+
+	result, ok := summary.(A)
+	if !ok {
+		return result, fmt.Errorf("%w: the aggregate summarises records as %T, not as %T", ErrUnsupported, summary, result)
+	}
+	return result, nil
+}
+
+// the summary of the records under the node with a key in the range
+// children that are entirely in the range use their summary, so only the paths to either end of the range are walked
+func (t *Tree[T]) aggregateUnder(n *node[T], keys KeyRange[T]) any {
+	agg := t.aggregate
+	summary := agg.identity()
+
+	if n.isLeaf {
+		for i, key := range n.keys[:n.numKeys] {
+			if !keys.Contains(key) {
+				continue
+			}
+			if record := t.recordAt(n, i, latestVersion); record != nil {
+				summary = agg.combine(summary, agg.of(record))
+			}
+		}
+		return summary
+	}
+
+	for i := range n.numKeys + 1 {
+		// the keys under the child are between the separators on either side of it, which it can hold as well when duplicates are allowed
+		var span KeyRange[T]
+		if i > 0 {
+			span.Low = Inclusive(n.keys[i-1])
+		}
+		if i < n.numKeys {
+			span.High = Inclusive(n.keys[i])
+		}
+
+		child := t.child(n, i)
+		switch {
+		case keys.misses(span):
+		case keys.covers(span):
+			summary = agg.combine(summary, child.summary)
+		default:
+			summary = agg.combine(summary, t.aggregateUnder(child, keys))
+		}
+	}
+	return summary
+}
+
+// whether the nodes keep counts or summaries of the records under them
+func (t *Tree[T]) summarized() bool {
+	return t.counted || t.aggregate != nil
+}
+
+// work out the count and summary of the node from its records, or from the counts and summaries of its children
+// keys that were deleted in the latest version are left out, like they are from every other read
+func (t *Tree[T]) summarize(n *node[T]) {
+	if !t.summarized() {
+		return
+	}
+
+	n.count = 0
+	if t.aggregate != nil {
+		n.summary = t.aggregate.identity()
+	}
+
+	if n.isLeaf {
+		for i := range n.numKeys {
+			record := t.recordAt(n, i, latestVersion)
+			if record == nil {
+				continue
+			}
+			n.count++
+			if t.aggregate != nil {
+				n.summary = t.aggregate.combine(n.summary, t.aggregate.of(record))
+			}
+		}
+		return
+	}
+
+	for i := range n.numKeys + 1 {
+		child := t.child(n, i)
+		n.count += child.count
+		if t.aggregate != nil {
+			n.summary = t.aggregate.combine(n.summary, child.summary)
+		}
+	}
+}
+
+// summarize the node and every node above it, for changes that do not change any other node's summary
+func (t *Tree[T]) summarizeUp(n *node[T]) {
+	if !t.summarized() {
+		return
+	}
+
+	for ; n != nil; n = n.parent {
+		t.summarize(n)
+	}
+}
@@ -0,0 +1,173 @@
+package bptree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// joins the labels of the records in key order, which only comes out right if summaries are combined in order
+var labelsInOrder = Aggregate[int, string]{
+	Of: func(record Record[int]) string {
+		return record.String() + " "
+	},
+	Combine: func(left string, right string) string {
+		return left + right
+	},
+}
+
+func keyOf(record Record[int]) int {
+	return record.GetHashableVal()
+}
+
+func TestAggregatesMatchModel(t *testing.T) {
+	for _, order := range []int{3, 4, 8} {
+		for _, duplicates := range []bool{false, true} {
+			t.Run(fmt.Sprintf("order %d, duplicates %v", order, duplicates), func(t *testing.T) {
+				opts := []TreeOption{WithOrder(order), WithAggregate(labelsInOrder)}
+				if duplicates {
+					opts = append(opts, WithDuplicates())
+				}
+				tree := NewTree[int](opts...)
+				records := make([]*labelledRecord, 0)
+				r := rand.New(rand.NewSource(int64(order)))
+
+				check := func() {
+					t.Helper()
+					for range 30 {
+						low := r.Intn(110) - 5
+						high := low + r.Intn(50)
+
+						inRange := make([]*labelledRecord, 0)
+						for _, record := range records {
+							if record.key >= low && record.key < high {
+								inRange = append(inRange, record)
+							}
+						}
+						expected := ""
+						for _, label := range modelOrder(inRange) {
+							expected += label + " "
+						}
+						if found, err := AggregateRange[string](tree, low, high); err != nil || found != expected {
+							t.Fatalf("Expected AggregateRange(%d, %d) to be %q, got %q", low, high, expected, found)
+						}
+					}
+				}
+
+				for i := range 1500 {
+					key := r.Intn(100)
+					if r.Intn(3) > 0 {
+						record := &labelledRecord{key, fmt.Sprint(i)}
+						if tree.Insert(record) == nil {
+							records = append(records, record)
+						}
+					} else if idx := slices.IndexFunc(records, func(record *labelledRecord) bool {
+						return record.key == key
+					}); idx != -1 {
+						tree.Delete(key)
+						records = slices.Delete(records, idx, idx+1)
+					}
+
+					if i%100 == 0 {
+						check()
+					}
+				}
+				check()
+
+				for _, record := range slices.Clone(records) {
+					tree.Delete(record.key)
+				}
+				records = records[:0]
+				check()
+			})
+		}
+	}
+}
+
+func TestAggregateSumAndMax(t *testing.T) {
+	sums := NewTree[int](WithOrder(3), WithAggregate(SumOf(keyOf)))
+	maxima := NewTree[int](WithOrder(3), WithAggregate(MaxOf(keyOf)), WithVersions())
+	for val := range 100 {
+		sums.Insert(NewIntRecord(val))
+		maxima.Insert(NewIntRecord(val))
+	}
+	for val := 50; val < 60; val++ {
+		sums.Delete(val)
+		maxima.Delete(val)
+	}
+
+	if found, err := AggregateRange[int](sums, 40, 70); err != nil || found != 40+41+42+43+44+45+46+47+48+49+60+61+62+63+64+65+66+67+68+69 {
+		t.Errorf("Unexpected sum %d", found)
+	}
+	if found, err := AggregateKeys[int](sums, KeyRange[int]{}); err != nil || found != 4950-545 {
+		t.Errorf("Expected the sum of every record, got %d", found)
+	}
+
+	// keys deleted in the latest version are left out, even though the tree still holds them
+	if found, err := AggregateRange[Extremum[int]](maxima, 0, 60); err != nil || found != (Extremum[int]{Value: 49, OK: true}) {
+		t.Errorf("Expected a maximum of 49, got %v", found)
+	}
+	if found, err := AggregateRange[Extremum[int]](maxima, 50, 60); err != nil || found.OK {
+		t.Errorf("Expected no maximum of a range without records, got %v", found)
+	}
+	if found, err := AggregateKeys[Extremum[int]](maxima, KeyRange[int]{Low: Exclusive(10), High: Inclusive(20)}); err != nil || found.Value != 20 {
+		t.Errorf("Expected a maximum of 20, got %v", found)
+	}
+
+	maxima.GC()
+	if found, err := AggregateRange[Extremum[int]](maxima, 0, 60); err != nil || found.Value != 49 {
+		t.Errorf("Expected a maximum of 49 after garbage collection, got %v", found)
+	}
+}
+
+func TestAggregatesOfOtherWrites(t *testing.T) {
+	records := make([]Record[int], 0)
+	for val := range 60 {
+		records = append(records, NewIntRecord(val*2))
+	}
+
+	minima := MinOf(keyOf)
+	tree, err := BulkLoad(NewSliceIterator(records), 0.7, WithOrder(4), WithAggregate(minima))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if found, err := AggregateRange[Extremum[int]](tree, 5, 100); err != nil || found.Value != 6 {
+		t.Errorf("Expected a minimum of 6, got %v", found)
+	}
+
+	// writers copy the nodes they change while the snapshot is open, which have to keep their summaries
+	snapshot := tree.Snapshot()
+	tx := tree.Begin()
+	for val := 1; val < 40; val += 2 {
+		tx.Insert(NewIntRecord(val))
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	snapshot.Close()
+
+	if found, err := AggregateRange[Extremum[int]](tree, 5, 100); err != nil || found.Value != 5 {
+		t.Errorf("Expected a minimum of 5, got %v", found)
+	}
+}
+
+func TestAggregateOfWrongType(t *testing.T) {
+	if _, err := AggregateRange[int](NewTree[int](), 0, 10); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported from a tree without an aggregate, got %v", err)
+	}
+	if _, err := AggregateRange[string](NewTree[int](WithAggregate(SumOf(keyOf))), 0, 10); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported from a summary of the wrong type, got %v", err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected an aggregate over the wrong key type to panic")
+		} else if !strings.Contains(fmt.Sprint(r), "ggregate") {
+			t.Errorf("Unexpected panic for an aggregate over the wrong key type: %v", r)
+		}
+	}()
+	NewTree[string](WithAggregate(SumOf(keyOf)))
+}
@@ -0,0 +1,423 @@
+package bptree
+
+import (
+	"cmp"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// BLinkTree is a B-link tree, a variant of Tree where readers never take a latch
+//
+// Every node carries a high key, the upper bound of the keys under it, and a link to its right sibling, on every level
+// A split moves the upper half of a node into a new right sibling before the parent hears about it,
+// so a reader that lands on a node that split underneath it simply moves right until the high key covers its key
+// Node contents are never changed in place, instead writers swap in a new copy, so readers can load them without latches
+//
+// Writers latch one node at a time, and never merge nodes, so a node can be left with few or no keys after deletes
+type BLinkTree[T cmp.Ordered] struct {
+	root atomic.Pointer[blinkNode[T]]
+	// held while a new root is put in place
+	rootMu sync.Mutex
+
+	maxKeysPerNode  int
+	leafSplitIndex  int
+	nonLeafSplitIdx int
+}
+
+type blinkNode[T cmp.Ordered] struct {
+	// only taken by writers
+	mu sync.Mutex
+
+	contents atomic.Pointer[blinkContents[T]]
+}
+
+// what a node holds at one point in time, which is never changed once it is stored in the node
+type blinkContents[T cmp.Ordered] struct {
+	// 0 for the leaves, counting up towards the root
+	level int
+
+	keys []T
+	// On a nonleaf node, the children, with one more pointer than keys
+	// On a leaf node, the records
+	pointers []interface{}
+
+	// every key under the node is less than the high key, which is only missing on the right most node of a level
+	highKey    T
+	hasHighKey bool
+	// the next node to the right on the same level
+	right *blinkNode[T]
+}
+
+// NewBLinkTree creates an empty B-link tree
+// Only the order applies, and any other option panics, since the tree does not support duplicates, versions, counts,
+// aggregates, validation or storage
+func NewBLinkTree[T cmp.Ordered](opts ...TreeOption) *BLinkTree[T] {
+	options := buildTreeOptions(opts)
+	if options.order < MIN_ORDER {
+		panic(fmt.Sprintf("Order must be at least %d, got %d", MIN_ORDER, options.order))
+	}
+	if unsupported := unsupportedByBLink(options); unsupported != "" {
+		panic(fmt.Sprintf("B-link trees do not support %s", unsupported))
+	}
+
+	maxKeysPerNode := options.order - 1
+	t := &BLinkTree[T]{
+		maxKeysPerNode:  maxKeysPerNode,
+		leafSplitIndex:  maxKeysPerNode / 2,
+		nonLeafSplitIdx: options.order / 2,
+	}
+
+	root := &blinkNode[T]{}
+	root.contents.Store(&blinkContents[T]{})
+	t.root.Store(root)
+	return t
+}
+
+// the first thing the options ask for that a B-link tree does not support, or "" if there is none
+func unsupportedByBLink(o treeOptions) string {
+	defaults := buildTreeOptions(nil)
+	switch {
+	case o.allowDuplicates:
+		return "duplicates"
+	case o.versioned:
+		return "versions"
+	case o.counted:
+		return "counts"
+	case o.aggregate != nil:
+		return "aggregates"
+	case o.validating:
+		return "validation"
+	case o.pageSize != defaults.pageSize || o.fs != defaults.fs || o.wal || o.checkpointSize != defaults.checkpointSize || o.memoryBudget != defaults.memoryBudget:
+		return "storage"
+	}
+	return ""
+}
+
+// whether the key is past the node, so it has to be looked for further right
+func (c *blinkContents[T]) coversPast(key T) bool {
+	return c.hasHighKey && key >= c.highKey
+}
+
+// the child to go down into for the key
+func (c *blinkContents[T]) childFor(key T) *blinkNode[T] {
+	ptrIdx := len(c.keys)
+	for i, k := range c.keys {
+		if key < k {
+			ptrIdx = i
+			break
+		}
+	}
+	return c.pointers[ptrIdx].(*blinkNode[T])
+}
+
+// go down to the node on the level that covers the key, without taking any latches
+// the nodes that were gone down from are returned by level, so that a split knows where to look for the parent
+func (t *BLinkTree[T]) descend(key T, level int) (*blinkNode[T], []*blinkNode[T]) {
+	current := t.root.Load()
+	c := current.contents.Load()
+	stack := make([]*blinkNode[T], c.level+1)
+
+	for {
+		// the node might have split since its parent was read
+		for c.coversPast(key) {
+			current = c.right
+			c = current.contents.Load()
+		}
+
+		if c.level == level {
+			return current, stack
+		}
+
+		stack[c.level] = current
+		current = c.childFor(key)
+		c = current.contents.Load()
+	}
+}
+
+// latch the node that covers the key, starting from n and moving right
+// latches are taken left to right, one at a time, so writers cannot deadlock
+func (t *BLinkTree[T]) latchCovering(n *blinkNode[T], key T) (*blinkNode[T], *blinkContents[T]) {
+	n.mu.Lock()
+	c := n.contents.Load()
+	for c.coversPast(key) {
+		right := c.right
+		right.mu.Lock()
+		n.mu.Unlock()
+
+		n, c = right, right.contents.Load()
+	}
+	return n, c
+}
+
+// FindPoint returns the record stored under the key
+// If there is none, ErrNotFound is returned, or ErrEmpty if the tree is a single leaf without any records
+// It does not take any latches
+func (t *BLinkTree[T]) FindPoint(val T) (Record[T], error) {
+	if root := t.root.Load().contents.Load(); root.level == 0 && len(root.keys) == 0 {
+		return nil, ErrEmpty
+	}
+
+	leaf, _ := t.descend(val, 0)
+	c := leaf.contents.Load()
+	for c.coversPast(val) {
+		c = c.right.contents.Load()
+	}
+
+	for i, key := range c.keys {
+		if key == val {
+			return c.pointers[i].(Record[T]), nil
+		}
+	}
+	return nil, notFound(val)
+}
+
+// Insert adds the record to the tree
+// If its key is already present, nothing is changed and ErrDuplicate is returned
+func (t *BLinkTree[T]) Insert(record Record[T]) error {
+	val := record.GetHashableVal()
+	leaf, stack := t.descend(val, 0)
+	leaf, c := t.latchCovering(leaf, val)
+
+	idx := len(c.keys)
+	for i, key := range c.keys {
+		if key == val {
+			leaf.mu.Unlock()
+			return fmt.Errorf("%w: %v", ErrDuplicate, val)
+		}
+		if val < key {
+			idx = i
+			break
+		}
+	}
+
+	updated := &blinkContents[T]{
+		keys:       insertAt(c.keys, idx, val),
+		pointers:   insertAt(c.pointers, idx, interface{}(record)),
+		highKey:    c.highKey,
+		hasHighKey: c.hasHighKey,
+		right:      c.right,
+	}
+	if len(updated.keys) <= t.maxKeysPerNode {
+		leaf.contents.Store(updated)
+		leaf.mu.Unlock()
+		return nil
+	}
+
+	// split the leaf, keeping the lower half in place
+	split := t.leafSplitIndex + 1
+	right := &blinkNode[T]{}
+	right.contents.Store(&blinkContents[T]{
+		keys:       updated.keys[split:],
+		pointers:   updated.pointers[split:],
+		highKey:    c.highKey,
+		hasHighKey: c.hasHighKey,
+		right:      c.right,
+	})
+
+	separator := updated.keys[split]
+	// the new node has to be in place before the left node links to it
+	leaf.contents.Store(&blinkContents[T]{
+		keys:       updated.keys[:split:split],
+		pointers:   updated.pointers[:split:split],
+		highKey:    separator,
+		hasHighKey: true,
+		right:      right,
+	})
+	leaf.mu.Unlock()
+
+	t.insertIntoParent(stack, leaf, separator, right, 0)
+	return nil
+}
+
+// link a node that was split off from left into the level above
+// until then, readers reach it through left's right link
+func (t *BLinkTree[T]) insertIntoParent(stack []*blinkNode[T], left *blinkNode[T], separator T, right *blinkNode[T], level int) {
+	for {
+		var parent *blinkNode[T]
+		if level+1 < len(stack) {
+			parent = stack[level+1]
+		} else if parent = t.parentOf(left, separator, level); parent == nil {
+			// left was the root, and the new root above it already holds both nodes
+			return
+		}
+
+		parent, c := t.latchCovering(parent, separator)
+
+		// separators are unique, so the key alone says where the new child goes,
+		// even if other splits on the same level got to the parent first
+		idx := len(c.keys)
+		for i, key := range c.keys {
+			if separator < key {
+				idx = i
+				break
+			}
+		}
+
+		keys := insertAt(c.keys, idx, separator)
+		pointers := insertAt(c.pointers, idx+1, interface{}(right))
+		if len(keys) <= t.maxKeysPerNode {
+			parent.contents.Store(&blinkContents[T]{
+				level:      c.level,
+				keys:       keys,
+				pointers:   pointers,
+				highKey:    c.highKey,
+				hasHighKey: c.hasHighKey,
+				right:      c.right,
+			})
+			parent.mu.Unlock()
+			return
+		}
+
+		// split the parent, with the middle key moving up rather than being copied
+		mid := t.nonLeafSplitIdx
+		newNode := &blinkNode[T]{}
+		newNode.contents.Store(&blinkContents[T]{
+			level:      c.level,
+			keys:       keys[mid+1:],
+			pointers:   pointers[mid+1:],
+			highKey:    c.highKey,
+			hasHighKey: c.hasHighKey,
+			right:      c.right,
+		})
+
+		nodeSeparator := keys[mid]
+		parent.contents.Store(&blinkContents[T]{
+			level:      c.level,
+			keys:       keys[:mid:mid],
+			pointers:   pointers[: mid+1 : mid+1],
+			highKey:    nodeSeparator,
+			hasHighKey: true,
+			right:      newNode,
+		})
+		parent.mu.Unlock()
+
+		left, separator, right, level = parent, nodeSeparator, newNode, level+1
+	}
+}
+
+// find the node on the level above left that the separator goes into, when the descent did not pass through one
+// if left is the root, a new root is put in place above it instead, and nil is returned
+func (t *BLinkTree[T]) parentOf(left *blinkNode[T], separator T, level int) *blinkNode[T] {
+	for {
+		t.rootMu.Lock()
+		root := t.root.Load()
+
+		if rootLevel := root.contents.Load().level; rootLevel > level {
+			t.rootMu.Unlock()
+			parent, _ := t.descend(separator, level+1)
+			return parent
+		}
+
+		if root == left {
+			right := left.contents.Load().right
+			newRoot := &blinkNode[T]{}
+			newRoot.contents.Store(&blinkContents[T]{
+				level:    level + 1,
+				keys:     []T{separator},
+				pointers: []interface{}{left, right},
+			})
+			t.root.Store(newRoot)
+			t.rootMu.Unlock()
+			return nil
+		}
+
+		// the root split as well, and the writer splitting it has not put the new root in place yet
+		t.rootMu.Unlock()
+		runtime.Gosched()
+	}
+}
+
+// Delete removes the record stored under the key, or returns ErrNotFound if it is not there
+// Nodes are never merged, so the leaf is left with one less key even if that leaves it empty
+func (t *BLinkTree[T]) Delete(val T) error {
+	leaf, _ := t.descend(val, 0)
+	leaf, c := t.latchCovering(leaf, val)
+	defer leaf.mu.Unlock()
+
+	for i, key := range c.keys {
+		if key == val {
+			leaf.contents.Store(&blinkContents[T]{
+				keys:       removeAt(c.keys, i),
+				pointers:   removeAt(c.pointers, i),
+				highKey:    c.highKey,
+				hasHighKey: c.hasHighKey,
+				right:      c.right,
+			})
+			return nil
+		}
+	}
+	return notFound(val)
+}
+
+// FindRange iterates over the records that satisfy low <= x < high, without taking any latches
+// Each leaf is read as it was when the scan got to it
+func (t *BLinkTree[T]) FindRange(low T, high T) Iterator[T] {
+	leaf, _ := t.descend(low, 0)
+	return &blinkIterator[T]{
+		contents: leaf.contents.Load(),
+		lastKey:  low,
+		high:     high,
+	}
+}
+
+type blinkIterator[T cmp.Ordered] struct {
+	contents *blinkContents[T]
+	idx      int
+
+	// keys up to the last one returned are skipped, since a leaf that split after the scan read it holds them twice
+	lastKey  T
+	returned bool
+	high     T
+}
+
+func (n *blinkIterator[T]) Next() Record[T] {
+	for n.contents != nil {
+		if n.idx == len(n.contents.keys) {
+			if n.contents.right == nil {
+				n.contents = nil
+				return nil
+			}
+			n.contents, n.idx = n.contents.right.contents.Load(), 0
+			continue
+		}
+
+		key := n.contents.keys[n.idx]
+		record := n.contents.pointers[n.idx]
+		n.idx++
+
+		if key < n.lastKey || (n.returned && key == n.lastKey) {
+			continue
+		}
+		if key >= n.high {
+			n.contents = nil
+			return nil
+		}
+
+		n.lastKey, n.returned = key, true
+		return record.(Record[T])
+	}
+
+	return nil
+}
+
+// a scan reads nothing but the contents of leaves that are already in memory, so it cannot fail part of the way
+func (n *blinkIterator[T]) Err() error {
+	return nil
+}
+
+// a copy of the slice with the value inserted at the index, leaving the original untouched
+func insertAt[E any](s []E, idx int, val E) []E {
+	updated := make([]E, 0, len(s)+1)
+	updated = append(updated, s[:idx]...)
+	updated = append(updated, val)
+	return append(updated, s[idx:]...)
+}
+
+// a copy of the slice without the value at the index, leaving the original untouched
+func removeAt[E any](s []E, idx int) []E {
+	updated := make([]E, 0, len(s)-1)
+	updated = append(updated, s[:idx]...)
+	return append(updated, s[idx+1:]...)
+}
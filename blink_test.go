@@ -0,0 +1,199 @@
+package bptree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestBLinkTreeMatchesModel(t *testing.T) {
+	for _, order := range []int{3, 4, 5, 8} {
+		t.Run(fmt.Sprintf("order %d", order), func(t *testing.T) {
+			tree := NewBLinkTree[int](WithOrder(order))
+			expected := make(map[int]bool)
+			r := rand.New(rand.NewSource(int64(order)))
+
+			for range 5000 {
+				val := r.Intn(500)
+				if r.Intn(3) != 0 {
+					if (tree.Insert(NewIntRecord(val)) == nil) == expected[val] {
+						t.Fatalf("Insert of %d did not match the expected contents", val)
+					}
+					expected[val] = true
+				} else {
+					if (tree.Delete(val) == nil) != expected[val] {
+						t.Fatalf("Delete of %d did not match the expected contents", val)
+					}
+					delete(expected, val)
+				}
+			}
+
+			expectedArr := make([]int, 0, len(expected))
+			for val := range expected {
+				expectedArr = append(expectedArr, val)
+			}
+			slices.Sort(expectedArr)
+
+			if keys := collectKeys(tree.FindRange(0, 500)); !slices.Equal(keys, expectedArr) {
+				t.Errorf("Contents did not match:\nExpected: %v\nGot: %v", expectedArr, keys)
+			}
+			if keys := collectKeys(tree.FindRange(100, 200)); !slices.Equal(keys, filterRange(expectedArr, 100, 200)) {
+				t.Errorf("Range did not match:\nExpected: %v\nGot: %v", filterRange(expectedArr, 100, 200), keys)
+			}
+			for val := range 500 {
+				if _, err := tree.FindPoint(val); (err == nil) != expected[val] {
+					t.Errorf("FindPoint of %d returned %v", val, err)
+				}
+			}
+			checkBLinkLevels(t, tree)
+		})
+	}
+}
+
+func TestBLinkTreeEmpty(t *testing.T) {
+	tree := NewBLinkTree[int]()
+	if record, err := tree.FindPoint(1); record != nil || !errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrEmpty from FindPoint on an empty tree, got %v and %v", record, err)
+	}
+	if err := tree.Delete(1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from Delete on an empty tree, got %v", err)
+	}
+	if keys := collectKeys(tree.FindRange(0, 10)); len(keys) != 0 {
+		t.Errorf("Expected an empty range, got %v", keys)
+	}
+}
+
+func TestBLinkTreeErrors(t *testing.T) {
+	tree := NewBLinkTree[int](WithOrder(3))
+	for val := range 10 {
+		if err := tree.Insert(NewIntRecord(val)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if err := tree.Insert(NewIntRecord(5)); !errors.Is(err, ErrDuplicate) || err.Error() != "bptree: duplicate key: 5" {
+		t.Errorf("Expected ErrDuplicate with the key, got %v", err)
+	}
+	if _, err := tree.FindPoint(20); !errors.Is(err, ErrNotFound) || errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := tree.Delete(20); !errors.Is(err, ErrNotFound) || err.Error() != "bptree: record not found: 20" {
+		t.Errorf("Expected ErrNotFound with the key, got %v", err)
+	}
+}
+
+func TestBLinkTreeRejectsUnsupportedOptions(t *testing.T) {
+	options := map[string]TreeOption{
+		"duplicates": WithDuplicates(),
+		"versions":   WithVersions(),
+		"counts":     WithCounts(),
+		"aggregates": WithAggregate(SumOf(keyOf)),
+		"validation": WithValidation(),
+		"storage":    WithWAL(),
+	}
+	for name, opt := range options {
+		func() {
+			defer func() {
+				if r := recover(); r != fmt.Sprintf("B-link trees do not support %s", name) {
+					t.Errorf("Expected %s to be rejected, got %v", name, r)
+				}
+			}()
+			NewBLinkTree[int](WithOrder(4), opt)
+		}()
+	}
+}
+
+func TestBLinkTreeConcurrentOperations(t *testing.T) {
+	for _, order := range []int{3, 4, 8} {
+		t.Run(fmt.Sprintf("order %d", order), func(t *testing.T) {
+			tree := NewBLinkTree[int](WithOrder(order))
+			runConcurrentOperations(t, tree)
+			checkBLinkLevels(t, tree)
+		})
+	}
+}
+
+func TestBLinkTreeConcurrentSplits(t *testing.T) {
+	// every writer inserting into the same end of the tree splits the same nodes over and over, including the root
+	tree := NewBLinkTree[int](WithOrder(3))
+	const writers = 8
+	const perWriter = 500
+
+	done := make(chan struct{})
+	for w := range writers {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for i := range perWriter {
+				tree.Insert(NewIntRecord(i*writers + w))
+			}
+		}()
+	}
+	for range writers {
+		<-done
+	}
+
+	keys := collectKeys(tree.FindRange(0, writers*perWriter))
+	if len(keys) != writers*perWriter {
+		t.Errorf("Expected %d keys, got %d", writers*perWriter, len(keys))
+	}
+	checkBLinkLevels(t, tree)
+}
+
+func filterRange(keys []int, low int, high int) []int {
+	filtered := make([]int, 0)
+	for _, val := range keys {
+		if val >= low && val < high {
+			filtered = append(filtered, val)
+		}
+	}
+	return filtered
+}
+
+// make sure that every level is in order from left to right, with the keys in each node under its high key,
+// and that the parents hold every node that was split off once the writers are done
+func checkBLinkLevels(t *testing.T, tree *BLinkTree[int]) {
+	leftmost := tree.root.Load()
+	for {
+		c := leftmost.contents.Load()
+		reachable := make(map[*blinkNode[int]]bool)
+		if c.level > 0 {
+			for n := leftmost; n != nil; n = n.contents.Load().right {
+				for _, ptr := range n.contents.Load().pointers {
+					reachable[ptr.(*blinkNode[int])] = true
+				}
+			}
+		}
+
+		var last *int
+		for n := leftmost; n != nil; n = n.contents.Load().right {
+			nc := n.contents.Load()
+			for _, key := range nc.keys {
+				if last != nil && key <= *last {
+					t.Errorf("Level %d is out of order, %d came after %d", nc.level, key, *last)
+				}
+				if nc.hasHighKey && key >= nc.highKey {
+					t.Errorf("Key %d on level %d is not under the high key %d", key, nc.level, nc.highKey)
+				}
+				last = &key
+			}
+
+			if nc.hasHighKey != (nc.right != nil) {
+				t.Errorf("Only the right most node on level %d should be missing a high key", nc.level)
+			}
+		}
+
+		if c.level == 0 {
+			return
+		}
+
+		child := c.pointers[0].(*blinkNode[int])
+		for n := child; n != nil; n = n.contents.Load().right {
+			if !reachable[n] {
+				t.Errorf("Node %v on level %d is not held by a parent", n.contents.Load().keys, c.level-1)
+			}
+		}
+		leftmost = child
+	}
+}
@@ -1,157 +1,548 @@
-package main
+// Package bptree implements an in-memory B+ tree keyed by any ordered type.
+//
+// Records are stored in the leaves, which are linked from left to right to support range queries.
+//
+// A Tree is safe for concurrent use. Operations latch the nodes they visit, and let go of a node's parent once
+// the operation cannot change it, so readers and writers in different parts of the tree do not wait on each other.
+package bptree
 
 import (
 	"cmp"
+	"container/list"
 	"fmt"
+	"sync"
+	"sync/atomic"
 )
 
-var (
-	ORDER                = 4 // each node has at most ORDER - 1 keys
-	MAX_KEYS_PER_NODE    = ORDER - 1
-	MAX_LEAF_POINTERS    = MAX_KEYS_PER_NODE
-	LEAF_SPLIT_INDEX     = MAX_LEAF_POINTERS / 2
-	MAX_NONLEAF_POINTERS = ORDER
-	MIN_NONLEAF_KEYS     = MAX_KEYS_PER_NODE / 2
-	MIN_LEAF_KEYS        = ORDER / 2
+const (
+	DEFAULT_ORDER = 4
+	// below this, a split leaves a node with no keys
+	MIN_ORDER = 3
 )
 
 // exceptions
 
 type Tree[T cmp.Ordered] struct {
-	Root *Node[T]
+	root *node[T]
+
+	// most operations share the tree and latch the nodes they visit, while the rest hold it to themselves
+	mu sync.RWMutex
+	// guards the root pointer, which changes when the root splits or runs out of keys
+	rootLatch sync.RWMutex
+
+	// limits derived from the order the tree was created with
+	// every tree carries its own, so trees of different fanouts can live side by side
+	order              int // each node has at most order - 1 keys
+	maxKeysPerNode     int
+	maxLeafPointers    int
+	leafSplitIndex     int
+	maxNonLeafPointers int
+	minNonLeafKeys     int
+	minLeafKeys        int
+
+	// when set, records with equal keys are all kept, next to each other in the leaves
+	allowDuplicates bool
+
+	// when set, every change gets a version, and leaves keep the records each key had in earlier versions
+	versioned bool
+	versions  versionState
+
+	// when set, every node keeps a count of the records under it, so records can be found by their position
+	counted bool
+	// when set, every node keeps a summary of the records under it, so ranges can be summarised without visiting every record
+	aggregate aggregator[T]
+
+	// when set, the whole tree is checked after every change, and after every split and merge along the way
+	validating bool
+	// the change that is being checked, which is only set while it is in progress
+	change *changeInProgress
+
+	// the file the tree is stored in, nil for trees that only live in memory
+	store *pageStore[T]
+
+	// bumped by every snapshot, so nodes from an earlier generation can be shared with one and have to be copied before they change
+	generation uint64
+	// how many snapshots are still open
+	snapshots atomic.Int64
+
+	// the error that ended the latest loop over All, Range, From or Backward, or nil if it did not end early
+	loopErr atomic.Pointer[error]
 }
 
-type Node[T cmp.Ordered] struct {
-	IsLeaf bool
+type node[T cmp.Ordered] struct {
+	isLeaf bool
 
 	// On a nonleaf node, this would be pointers to child nodes
 	//
 	// On a leaf node, this would be pointers to record values
 	// Additionally, the final pointer is used to point to the next child in the line, from left to right
 	//
+	// On a tree stored in a file, nodes are linked to by their page id rather than pointed to, see link
+	//
 	// The interface{} type helps this function as a void*
-	Pointers []interface{}
+	pointers []interface{}
 
 	// use a generic []int type since you dont know how many keys there will be
-	Keys    []T
-	NumKeys int
+	keys    []T
+	numKeys int
+
+	// on a tree stored in a file, this is only set while the parent is resident as well
+	parent *node[T]
+
+	// on a leaf node, the previous leaf in the line, from right to left, which mirrors the final pointer
+	// like the final pointer, it is guarded by the node's latch
+	// it is not part of the node's page, so trees stored in a file go without it
+	prev *node[T]
+
+	// where the node is stored, and how many levels it is above the leaves, for trees that are stored in a file
+	pageID uint64
+	level  int
+
+	// for trees stored in a file, the node is only in memory while it is resident in the buffer pool
+	frame *list.Element
+	// how many times the operation in progress has fetched the node, which keeps it from being evicted
+	pins int
+
+	// guards the node's keys, pointers and the parent of its children, for operations that share the tree
+	latch sync.RWMutex
+	// on a tree created with WithCounts, how many records there are under the node as of the latest version
+	count int
+	// on a tree created with WithAggregate, the summary of the records under the node as of the latest version
+	summary any
+
+	// bumped on every change, so that a scan that let go of the node can tell whether its place is still valid
+	version uint64
+	// the tree's generation when the node was created
+	generation uint64
+}
+
+type treeOptions struct {
+	order           int
+	allowDuplicates bool
+	versioned       bool
+	counted         bool
+	validating      bool
+	// an Aggregate, which is only checked against the tree's key type once the tree is created
+	aggregate any
+
+	// only used by trees opened with Open
+	pageSize       int
+	fs             FS
+	wal            bool
+	checkpointSize int64
+	memoryBudget   int64
+}
+
+// TreeOption configures a tree when it is created with NewTree
+type TreeOption func(*treeOptions)
+
+// WithOrder sets the maximum number of pointers in a node, so each node holds at most order - 1 keys
+func WithOrder(order int) TreeOption {
+	return func(o *treeOptions) {
+		o.order = order
+	}
+}
+
+// WithMaxKeysPerNode sets the maximum number of keys in a node, which is one less than the order
+func WithMaxKeysPerNode(maxKeys int) TreeOption {
+	return func(o *treeOptions) {
+		o.order = maxKeys + 1
+	}
+}
+
+// WithDuplicates lets the tree hold several records with the same key, so that it can be used as a non-unique index
+func WithDuplicates() TreeOption {
+	return func(o *treeOptions) {
+		o.allowDuplicates = true
+	}
+}
 
-	Parent *Node[T]
+func NewTree[T cmp.Ordered](opts ...TreeOption) *Tree[T] {
+	return newTree[T](buildTreeOptions(opts))
 }
 
-func NewTree[T cmp.Ordered]() *Tree[T] {
+func buildTreeOptions(opts []TreeOption) treeOptions {
+	options := treeOptions{
+		order:          DEFAULT_ORDER,
+		pageSize:       DEFAULT_PAGE_SIZE,
+		fs:             OSFS{},
+		checkpointSize: DEFAULT_CHECKPOINT_SIZE,
+		memoryBudget:   DEFAULT_MEMORY_BUDGET,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+func newTree[T cmp.Ordered](options treeOptions) *Tree[T] {
+	if options.order < MIN_ORDER {
+		panic(fmt.Sprintf("Order must be at least %d, got %d", MIN_ORDER, options.order))
+	}
+
+	if options.versioned && options.allowDuplicates {
+		panic("Versions cannot be kept for trees that allow duplicates")
+	}
+
+	var aggregate aggregator[T]
+	if options.aggregate != nil {
+		var ok bool
+		if aggregate, ok = options.aggregate.(aggregator[T]); !ok {
+			panic(fmt.Sprintf("Aggregate is for a different key type than the tree, got %T", options.aggregate))
+		}
+	}
+
+	maxKeysPerNode := options.order - 1
 	return &Tree[T]{
-		Root: nil,
+		root: nil,
+
+		order:              options.order,
+		maxKeysPerNode:     maxKeysPerNode,
+		maxLeafPointers:    maxKeysPerNode,
+		leafSplitIndex:     maxKeysPerNode / 2,
+		maxNonLeafPointers: options.order,
+		minNonLeafKeys:     maxKeysPerNode / 2,
+		minLeafKeys:        options.order / 2,
+
+		allowDuplicates: options.allowDuplicates,
+		versioned:       options.versioned,
+		counted:         options.counted,
+		aggregate:       aggregate,
+		validating:      options.validating,
 	}
 }
 
-func NewNode[T cmp.Ordered]() *Node[T] {
-	node := Node[T]{
-		Pointers: make([]interface{}, ORDER),
-		Keys:     make([]T, MAX_KEYS_PER_NODE),
-		NumKeys:  0,
-		IsLeaf:   false,
+// Order returns the maximum number of pointers in each of the tree's nodes
+func (t *Tree[T]) Order() int {
+	return t.order
+}
+
+func (t *Tree[T]) newNode() *node[T] {
+	n := node[T]{
+		pointers: make([]interface{}, t.order),
+		keys:     make([]T, t.maxKeysPerNode),
+		numKeys:  0,
+		isLeaf:   false,
+
+		generation: t.generation,
 	}
-	for i := range node.Pointers {
-		node.Pointers[i] = nil
+	for i := range n.pointers {
+		n.pointers[i] = nil
 	}
 
-	return &node
+	if t.store != nil {
+		n.pageID = t.store.allocate()
+		t.store.nodes[n.pageID] = &n
+		t.markDirty(&n)
+
+		// new nodes start off resident, and stay pinned until the operation creating them is done
+		t.pin(&n)
+	}
+
+	return &n
 }
 
 // insertion functions
-func (t *Tree[T]) Insert(record Record[T]) {
+
+// Insert adds the record to the tree
+// If its key is already present, nothing is changed and ErrDuplicate is returned
+func (t *Tree[T]) Insert(record Record[T]) error {
+	_, inserted, err := t.insert(record, false)
+	if err == nil && !inserted {
+		err = fmt.Errorf("%w: %v", ErrDuplicate, record.GetHashableVal())
+	}
+	return err
+}
+
+// Upsert adds the record to the tree, or swaps it in for the record already stored under its key
+// The previous record is returned, or nil if the key was not present
+func (t *Tree[T]) Upsert(record Record[T]) (Record[T], error) {
+	previous, _, err := t.insert(record, true)
+	return previous, err
+}
+
+// Replace swaps the record in for the record already stored under its key, and returns the previous record
+// If the key is not present, nothing is inserted and ErrNotFound is returned
+func (t *Tree[T]) Replace(record Record[T]) (previous Record[T], err error) {
+	defer t.catchCorrupt(&err)
+
+	// looking for the record when duplicates are allowed can walk a run of equal keys outside of the latched path
+	mode := latchLeaf
+	if t.allowDuplicates {
+		mode = latchNone
+	}
+	mode, unlock := t.lockTree(mode)
+	defer unlock()
+
+	if !t.writable() {
+		return nil, t.notWritable()
+	}
+	if t.isEmpty() {
+		return nil, ErrEmpty
+	}
+	defer t.commitInto(&err)
+	defer t.validateChange("Replace", record.GetHashableVal())()
+
+	leaf, idx, latches := t.findFirst(record.GetHashableVal(), mode)
+	defer latches.release()
+	if leaf != nil {
+		previous = t.recordAt(leaf, idx, latestVersion)
+	}
+	if previous == nil {
+		return nil, notFound(record.GetHashableVal())
+	}
+
+	// keys are unchanged, so the record can be swapped without touching the tree's structure
+	if err := t.checkFits(leaf, idx, record, true); err != nil {
+		return nil, err
+	}
+	t.setRecord(leaf, idx, record)
+	return previous, nil
+}
+
+// if the key is already present, the existing record is returned, and is only swapped out when replace is set
+// trees that allow duplicates only look for an existing record to replace
+func (t *Tree[T]) insert(record Record[T], replace bool) (existing Record[T], inserted bool, err error) {
+	defer t.catchCorrupt(&err)
+
+	// looking for a record to replace when duplicates are allowed can walk a run of equal keys outside of the latched path
+	mode := latchInsert
+	if t.allowDuplicates && replace {
+		mode = latchNone
+	}
+	mode, unlock := t.lockTree(mode)
+	defer unlock()
+
+	if !t.writable() {
+		return nil, false, t.notWritable()
+	}
+	defer t.commitInto(&err)
+	if replace {
+		defer t.validateChange("Upsert", record.GetHashableVal())()
+	} else {
+		defer t.validateChange("Insert", record.GetHashableVal())()
+	}
+
+	return t.insertRecord(record, replace, mode)
+}
+
+// insert the record into a tree that is already locked, with the mode it was locked in
+// on a stored tree, a record that would leave a node too large for a page is turned away with ErrPageFull, leaving the tree as it was
+func (t *Tree[T]) insertRecord(record Record[T], replace bool, mode latchMode) (Record[T], bool, error) {
 	// set up an empty tree
-	if t.Root == nil {
-		t.Root = NewNode[T]()
-		t.Root.IsLeaf = true
-		t.Root.Parent = nil
+	t.rootLatch.Lock()
+	if t.root == nil {
+		if err := t.checkFits(nil, 0, record, false); err != nil {
+			t.rootLatch.Unlock()
+			return nil, false, err
+		}
+		t.root = t.newNode()
+		t.root.isLeaf = true
+		t.root.parent = nil
+	}
+	t.rootLatch.Unlock()
+
+	if t.allowDuplicates && replace {
+		if leaf, idx, _ := t.findFirst(record.GetHashableVal(), mode); leaf != nil {
+			if err := t.checkFits(leaf, idx, record, true); err != nil {
+				return nil, false, err
+			}
+			existing := t.recordAt(leaf, idx, latestVersion)
+			t.setRecord(leaf, idx, record)
+			return existing, false, nil
+		}
 	}
 
+	// equal keys go to the right of the separator, so duplicates are added at the end of their run
+	leaf, latches := t.findNode(record.GetHashableVal(), mode)
+	defer latches.release()
+
 	// do not make an additional insertion if the node already exists
-	if r := t.FindPoint(record.GetHashableVal()); r != nil {
-		return
+	if !t.allowDuplicates {
+		if idx := findItemIndex(leaf, record.GetHashableVal()); idx != -1 {
+			// on a versioned tree, a key that was deleted is still there, and is inserted again as a new version
+			existing := t.recordAt(leaf, idx, latestVersion)
+			if replace || existing == nil {
+				if err := t.checkFits(leaf, idx, record, true); err != nil {
+					return nil, false, err
+				}
+				t.setRecord(leaf, idx, record)
+			}
+			return existing, existing == nil, nil
+		}
+	}
+
+	if err := t.checkFits(leaf, findInsertionIndex(leaf, record), record, false); err != nil {
+		return nil, false, err
 	}
+	t.insertIntoLeaf(t.unshare(leaf), record)
+	return nil, true, nil
+}
+
+// whether the tree has no root yet, which it only has once the first record is inserted
+func (t *Tree[T]) isEmpty() bool {
+	t.rootLatch.RLock()
+	defer t.rootLatch.RUnlock()
+
+	return t.root == nil
+}
 
-	nodeToInsertValue := t.findNode(record.GetHashableVal())
+func (t *Tree[T]) insertIntoLeaf(nodeToInsertValue *node[T], record Record[T]) {
 	indexToInsertVal := findInsertionIndex(nodeToInsertValue, record)
+	t.markDirty(nodeToInsertValue)
+	pointer := t.leafPointer(record, nil)
 
-	if nodeToInsertValue.NumKeys < MAX_KEYS_PER_NODE {
-		for i := nodeToInsertValue.NumKeys - 1; i >= indexToInsertVal; i-- {
-			nodeToInsertValue.Keys[i+1] = nodeToInsertValue.Keys[i]
-			nodeToInsertValue.Pointers[i+1] = nodeToInsertValue.Pointers[i]
+	if nodeToInsertValue.numKeys < t.maxKeysPerNode {
+		for i := nodeToInsertValue.numKeys - 1; i >= indexToInsertVal; i-- {
+			nodeToInsertValue.keys[i+1] = nodeToInsertValue.keys[i]
+			nodeToInsertValue.pointers[i+1] = nodeToInsertValue.pointers[i]
 		}
 
-		nodeToInsertValue.Keys[indexToInsertVal] = record.GetHashableVal()
-		nodeToInsertValue.Pointers[indexToInsertVal] = record
-		nodeToInsertValue.NumKeys++
+		nodeToInsertValue.keys[indexToInsertVal] = record.GetHashableVal()
+		nodeToInsertValue.pointers[indexToInsertVal] = pointer
+		nodeToInsertValue.numKeys++
+		t.summarizeUp(nodeToInsertValue)
 		return
 	}
 
 	// split the node
-	tempKeys := make([]T, MAX_NONLEAF_POINTERS)
-	tempPointers := make([]interface{}, MAX_NONLEAF_POINTERS)
+	tempKeys := make([]T, t.maxNonLeafPointers)
+	tempPointers := make([]interface{}, t.maxNonLeafPointers)
 
-	for i, j := 0, 0; i < MAX_NONLEAF_POINTERS; i++ {
+	for i, j := 0, 0; i < t.maxNonLeafPointers; i++ {
 		if i == indexToInsertVal {
 			tempKeys[i] = record.GetHashableVal()
-			tempPointers[i] = record
+			tempPointers[i] = pointer
 			continue
 		}
 
-		tempKeys[i] = nodeToInsertValue.Keys[j]
-		tempPointers[i] = nodeToInsertValue.Pointers[j]
+		tempKeys[i] = nodeToInsertValue.keys[j]
+		tempPointers[i] = nodeToInsertValue.pointers[j]
 		j++
 	}
 
 	// put the keys and pointers into the original node
-	nodeToInsertValue.NumKeys = 0
-	for i := range LEAF_SPLIT_INDEX + 1 {
-		nodeToInsertValue.Keys[i] = tempKeys[i]
-		nodeToInsertValue.Pointers[i] = tempPointers[i]
-		nodeToInsertValue.NumKeys++
+	nodeToInsertValue.numKeys = 0
+	for i := range t.leafSplitIndex + 1 {
+		nodeToInsertValue.keys[i] = tempKeys[i]
+		nodeToInsertValue.pointers[i] = tempPointers[i]
+		nodeToInsertValue.numKeys++
 	}
+	// clear the moved records so that they are not held onto twice
+	for i := t.leafSplitIndex + 1; i < t.maxLeafPointers; i++ {
+		nodeToInsertValue.pointers[i] = nil
+	}
+
+	newNode := t.newNode()
+	newNode.isLeaf = true
 
-	newNode := NewNode[T]()
-	newNode.IsLeaf = true
+	for i, j := 0, t.leafSplitIndex+1; j < t.maxNonLeafPointers; i, j = i+1, j+1 {
+		newNode.keys[i] = tempKeys[j]
+		newNode.pointers[i] = tempPointers[j]
+		newNode.numKeys++
+	}
 
 	// make the old node point to the new node with the last pointer
 	// this will help support range queries
-	nodeToInsertValue.Pointers[MAX_LEAF_POINTERS] = newNode
+	newNode.pointers[t.maxLeafPointers] = nodeToInsertValue.pointers[t.maxLeafPointers]
+	nodeToInsertValue.pointers[t.maxLeafPointers] = t.link(newNode)
+	t.linkBack(nodeToInsertValue)
+	t.linkBack(newNode)
+	t.summarize(nodeToInsertValue)
+	t.summarize(newNode)
+
+	t.insertIntoParentNode(nodeToInsertValue, newNode, nodeToInsertValue.parent, newNode.keys[0])
+}
 
-	for i, j := 0, LEAF_SPLIT_INDEX+1; j < MAX_NONLEAF_POINTERS; i, j = i+1, j+1 {
-		newNode.Keys[i] = tempKeys[j]
-		newNode.Pointers[i] = tempPointers[j]
-		newNode.NumKeys++
+// point the leaf after the leaf back at it
+// the next leaf is outside of the latched path, but leaves are only latched right to left by scans that back off rather than wait,
+// so this cannot deadlock
+// trees stored in a file do not link back, and find the leaf before a leaf through its parents instead
+func (t *Tree[T]) linkBack(leaf *node[T]) {
+	if t.store != nil {
+		return
+	}
+	next, ok := leaf.pointers[t.maxLeafPointers].(*node[T])
+	if !ok {
+		return
 	}
 
-	// set the last pointers to make a linked list
-	newNode.Pointers[MAX_LEAF_POINTERS] = nodeToInsertValue.Pointers[MAX_LEAF_POINTERS]
-	nodeToInsertValue.Pointers[MAX_LEAF_POINTERS] = newNode
+	next.latch.Lock()
+	next.prev = leaf
+	next.latch.Unlock()
+}
 
-	if record, ok := newNode.Pointers[0].(Record[T]); ok {
-		t.insertIntoParentNode(nodeToInsertValue, newNode, nodeToInsertValue.Parent, record.GetHashableVal())
-	} else {
-		panic("No hashable value for the new node")
+// the leaf after the leaf, or false if it is the last one
+// on a tree stored in a file, it is found through the parents of the leaf rather than the link between them, so that its own parents are known as well
+func (t *Tree[T]) nextLeaf(leaf *node[T]) (*node[T], bool) {
+	if t.store == nil {
+		next, ok := leaf.pointers[t.maxLeafPointers].(*node[T])
+		return next, ok
+	}
+	return t.neighborLeaf(leaf, 1)
+}
+
+// the leaf before the leaf, or false if it is the first one
+func (t *Tree[T]) prevLeaf(leaf *node[T]) (*node[T], bool) {
+	if t.store == nil {
+		return leaf.prev, leaf.prev != nil
+	}
+	return t.neighborLeaf(leaf, -1)
+}
+
+// the leaf next to the leaf on the side of the step, which is 1 for the right and -1 for the left, found by going up from the leaf
+// until there is a child on that side of the path, and back down the near edge of that child
+// every node above the leaf has to be on the path the operation took down to it
+func (t *Tree[T]) neighborLeaf(leaf *node[T], step int) (*node[T], bool) {
+	depth := 0
+	n := leaf
+	for n != t.root {
+		if n.parent == nil {
+			corrupt(n, "could not find the node's parent")
+		}
+		idx := t.getNodeIndexInParent(n, n.parent)
+		if idx == -1 {
+			corrupt(n, "could not find node idx")
+		}
+
+		n, depth = n.parent, depth+1
+		if idx+step < 0 || idx+step > n.numKeys {
+			continue
+		}
+
+		n = t.child(n, idx+step)
+		for range depth - 1 {
+			if step > 0 {
+				n = t.child(n, 0)
+			} else {
+				n = t.child(n, n.numKeys)
+			}
+		}
+		return n, true
 	}
+	return nil, false
 }
 
 // assume that left is the original node that was not split before this
-func (t *Tree[T]) insertIntoParentNode(left *Node[T], right *Node[T], parent *Node[T], separator T) {
+func (t *Tree[T]) insertIntoParentNode(left *node[T], right *node[T], parent *node[T], separator T) {
 	// since left was the original node, if it does not have a parent node, it must be the original root
 	if parent == nil {
-		newRoot := NewNode[T]()
-		newRoot.Keys[0] = separator
-		newRoot.NumKeys++
-		newRoot.IsLeaf = false
+		newRoot := t.newNode()
+		newRoot.keys[0] = separator
+		newRoot.numKeys++
+		newRoot.isLeaf = false
 
-		left.Parent = newRoot
-		right.Parent = newRoot
+		left.parent = newRoot
+		right.parent = newRoot
 
-		newRoot.Pointers[0] = left
-		newRoot.Pointers[1] = right
+		newRoot.pointers[0] = t.link(left)
+		newRoot.pointers[1] = t.link(right)
+		newRoot.level = left.level + 1
+		t.summarize(newRoot)
 
-		t.Root = newRoot
+		t.root = newRoot
+		t.validateStep("split in insertIntoParentNode")
 		return
 	}
 
@@ -159,84 +550,91 @@ func (t *Tree[T]) insertIntoParentNode(left *Node[T], right *Node[T], parent *No
 	// if the number keys has not yet been maxed, the index of the key to modify is idx
 	foundIdx := t.getNodeIndexInParent(left, parent)
 	if foundIdx == -1 {
-		panic("Could not find node idx")
+		corrupt(left, "could not find node idx")
 	}
 
+	// the new node starts off under the parent, and is moved if the parent has to split
+	right.parent = parent
+	t.markDirty(parent)
+
 	indexToInsertNewNode := foundIdx + 1
-	if parent.NumKeys < MAX_KEYS_PER_NODE {
+	if parent.numKeys < t.maxKeysPerNode {
 		// copy all the keys over
-		for i := parent.NumKeys; i >= indexToInsertNewNode; i-- {
-			parent.Keys[i] = parent.Keys[i-1]
-			parent.Pointers[i+1] = parent.Pointers[i]
+		for i := parent.numKeys; i >= indexToInsertNewNode; i-- {
+			parent.keys[i] = parent.keys[i-1]
+			parent.pointers[i+1] = parent.pointers[i]
 		}
 
-		parent.Keys[indexToInsertNewNode-1] = separator
-		parent.Pointers[indexToInsertNewNode] = right
-		parent.NumKeys++
-
-		right.Parent = parent
+		parent.keys[indexToInsertNewNode-1] = separator
+		parent.pointers[indexToInsertNewNode] = t.link(right)
+		parent.numKeys++
+		t.summarizeUp(parent)
 
+		// a split is only done once it stops cascading up the tree, which is here or at a new root
+		t.validateStep("split in insertIntoParentNode")
 		return
 	}
 
 	// if not, split the parent node
 	// when trying to split a nonleaf node, there will be one more pointer than key
-	tempKeys := make([]T, MAX_NONLEAF_POINTERS)
-	tempPointers := make([]interface{}, MAX_NONLEAF_POINTERS+1)
+	tempKeys := make([]T, t.maxNonLeafPointers)
+	tempPointers := make([]interface{}, t.maxNonLeafPointers+1)
 
-	for i, j := 0, 0; i < MAX_NONLEAF_POINTERS+1; i++ {
+	for i, j := 0, 0; i < t.maxNonLeafPointers+1; i++ {
 		if i == indexToInsertNewNode {
-			tempPointers[i] = right
+			tempPointers[i] = t.link(right)
 			continue
 		}
-		tempPointers[i] = parent.Pointers[j]
+		tempPointers[i] = parent.pointers[j]
 		j++
 	}
 
-	for i, j := 0, 0; i < MAX_NONLEAF_POINTERS; i++ {
+	for i, j := 0, 0; i < t.maxNonLeafPointers; i++ {
 		if i == indexToInsertNewNode-1 {
-			if record, ok := right.Pointers[0].(Record[T]); ok {
-				tempKeys[i] = record.GetHashableVal()
-				continue
-			}
+			tempKeys[i] = separator
+			continue
 		}
 
-		tempKeys[i] = parent.Keys[j]
+		tempKeys[i] = parent.keys[j]
 		j++
 	}
 
-	for i := range MAX_LEAF_POINTERS {
-		if i < LEAF_SPLIT_INDEX {
-			parent.Keys[i] = tempKeys[i]
-			parent.Pointers[i] = tempPointers[i]
+	for i := range t.maxKeysPerNode {
+		if i < t.leafSplitIndex {
+			parent.keys[i] = tempKeys[i]
+			parent.pointers[i] = tempPointers[i]
 		} else {
-			parent.Pointers[i] = nil
-			parent.NumKeys--
+			parent.pointers[i] = nil
+			parent.numKeys--
 		}
 	}
-	parent.Pointers[LEAF_SPLIT_INDEX] = tempPointers[LEAF_SPLIT_INDEX]
-	nodeSeparator := tempKeys[LEAF_SPLIT_INDEX]
-
-	newNode := NewNode[T]()
-	for i, j := 0, LEAF_SPLIT_INDEX+1; j < MAX_NONLEAF_POINTERS+1; i, j = i+1, j+1 {
-		if j < MAX_NONLEAF_POINTERS {
-			newNode.Keys[i] = tempKeys[j]
-			newNode.NumKeys++
+	parent.pointers[t.maxKeysPerNode] = nil
+	parent.pointers[t.leafSplitIndex] = tempPointers[t.leafSplitIndex]
+	nodeSeparator := tempKeys[t.leafSplitIndex]
+
+	newNode := t.newNode()
+	newNode.level = parent.level
+	for i, j := 0, t.leafSplitIndex+1; j < t.maxNonLeafPointers+1; i, j = i+1, j+1 {
+		if j < t.maxNonLeafPointers {
+			newNode.keys[i] = tempKeys[j]
+			newNode.numKeys++
 		}
 
-		// some issue abuout not setting parent
-		newNode.Pointers[i] = tempPointers[j]
-		if nn, ok := newNode.Pointers[i].(*Node[T]); ok {
-			nn.Parent = newNode
-		}
+		// the children that moved over have a new parent
+		newNode.pointers[i] = tempPointers[j]
+		t.adopt(newNode, i)
 	}
+	t.summarize(parent)
+	t.summarize(newNode)
 
-	t.insertIntoParentNode(parent, newNode, parent.Parent, nodeSeparator)
+	t.insertIntoParentNode(parent, newNode, parent.parent, nodeSeparator)
 }
 
-func (t *Tree[T]) getNodeIndexInParent(node *Node[T], parent *Node[T]) int {
-	for i, ptr := range parent.Pointers {
-		if ptr == node {
+func (t *Tree[T]) getNodeIndexInParent(node *node[T], parent *node[T]) int {
+	t.fetch(parent)
+	link := t.link(node)
+	for i, ptr := range parent.pointers[:parent.numKeys+1] {
+		if ptr == link {
 			return i
 		}
 	}
@@ -246,199 +644,412 @@ func (t *Tree[T]) getNodeIndexInParent(node *Node[T], parent *Node[T]) int {
 
 // Find node that would contain the desired value
 // This does not guarantee that the value is found, only that the desired node is found
-func (t *Tree[T]) findNode(val T) *Node[T] {
-	if t.Root == nil {
+func (t *Tree[T]) findNode(val T, mode latchMode) (*node[T], *latchPath[T]) {
+	return t.findNodeBy(val, mode, func(val T, key T) bool {
+		return val < key
+	})
+}
+
+// Find the left most node that could contain the desired value
+// When duplicates are allowed, a run of equal keys can start to the left of the separator with the same key
+func (t *Tree[T]) findLeftmostNode(val T, mode latchMode) (*node[T], *latchPath[T]) {
+	return t.findNodeBy(val, mode, func(val T, key T) bool {
+		return val <= key
+	})
+}
+
+// find the left most leaf in the tree
+func (t *Tree[T]) findFirstLeaf(mode latchMode) (*node[T], *latchPath[T]) {
+	var val T
+	return t.findNodeBy(val, mode, func(val T, key T) bool {
+		return true
+	})
+}
+
+// find the right most leaf in the tree
+func (t *Tree[T]) findLastLeaf(mode latchMode) (*node[T], *latchPath[T]) {
+	var val T
+	return t.findNodeBy(val, mode, func(val T, key T) bool {
+		return false
+	})
+}
+
+// descend into the pointer on the left of the first key that goLeft returns true for
+// the leaf is returned latched, along with whatever the mode needs to keep latched above it, which the caller releases
+func (t *Tree[T]) findNodeBy(val T, mode latchMode, goLeft func(T, T) bool) (*node[T], *latchPath[T]) {
+	latches := &latchPath[T]{tree: t, mode: mode}
+	switch mode {
+	case latchNone:
+	case latchRead:
+		t.rootLatch.RLock()
+		latches.root = true
+	default:
+		t.rootLatch.Lock()
+		latches.root = true
+	}
+
+	if t.root == nil {
+		latches.release()
 		panic("Tree is empty")
 	}
 
-	var currentNode *Node[T] = t.Root
+	var currentNode *node[T] = t.fetch(t.root)
+	latches.latch(currentNode)
+	if mode == latchRead || t.safe(currentNode, true, mode) {
+		latches.releaseAbove()
+	}
 
-	for !currentNode.IsLeaf {
-		ptrIdx := currentNode.NumKeys
+	for !currentNode.isLeaf {
+		ptrIdx := currentNode.numKeys
 		// find the right key
-		for i, key := range currentNode.Keys[:currentNode.NumKeys] {
-			if val < key {
+		for i, key := range currentNode.keys[:currentNode.numKeys] {
+			if goLeft(val, key) {
 				ptrIdx = i
 				break
 			}
 		}
-		if node, ok := currentNode.Pointers[ptrIdx].(*Node[T]); ok {
+		if node, ok := t.followChild(currentNode, ptrIdx); ok {
 			currentNode = node
 		} else {
-			panic(fmt.Sprintf("Found a non node in a nonleaf pointer: %+v, \n\n%s\n", currentNode, t))
+			latches.release()
+			corrupt(currentNode, fmt.Sprintf("found a %T in a nonleaf pointer", currentNode.pointers[ptrIdx]))
+		}
+
+		// latch the child before letting go of anything above it
+		latches.latch(currentNode)
+		if mode == latchRead || t.safe(currentNode, false, mode) {
+			latches.releaseAbove()
 		}
 	}
 
-	return currentNode
+	return currentNode, latches
 }
 
 // given a record and value, find the right place to insert the new value
 // TODO: are we supposed to be able to do binary search here? I cant think of a way to do that
-func findInsertionIndex[T cmp.Ordered](currentSearchNode *Node[T], record Record[T]) int {
-	if !currentSearchNode.IsLeaf {
-		panic("Cannot find insertion index for something that is not a child node")
+func findInsertionIndex[T cmp.Ordered](currentSearchNode *node[T], record Record[T]) int {
+	if !currentSearchNode.isLeaf {
+		corrupt(currentSearchNode, "cannot find insertion index for something that is not a child node")
 	}
 
-	if currentSearchNode.NumKeys == 0 {
+	if currentSearchNode.numKeys == 0 {
 		return 0
 	}
 
 	target := record.GetHashableVal()
 
-	for i, key := range currentSearchNode.Keys {
+	for i, key := range currentSearchNode.keys[:currentSearchNode.numKeys] {
 		if target < key {
 			return i
 		}
 	}
 
-	return currentSearchNode.NumKeys
+	return currentSearchNode.numKeys
 }
 
 // function to search for an item using equality
-func (t *Tree[T]) FindPoint(val T) Record[T] {
-	targetNode := t.findNode(val)
-	record, _ := findItemIndex(targetNode, val)
-	return record
+// if duplicates are allowed, the first record with the key is returned
+// if there is none, ErrNotFound is returned, or ErrEmpty if the tree has no records at all
+func (t *Tree[T]) FindPoint(val T, opts ...ReadOption) (record Record[T], err error) {
+	defer t.catchCorrupt(&err)
+
+	asOf, err := t.readVersion(opts)
+	if err != nil {
+		return nil, err
+	}
+	mode, unlock := t.lockTree(latchRead)
+	defer unlock()
+	defer t.release()
+	t.checkVersion(asOf)
+
+	if t.isEmpty() {
+		return nil, ErrEmpty
+	}
+
+	leaf, idx, latches := t.findFirst(val, mode)
+	defer latches.release()
+	if leaf != nil {
+		record = t.recordAt(leaf, idx, asOf)
+	}
+	if record == nil {
+		return nil, notFound(val)
+	}
+	return record, nil
+}
+
+// find the leaf and index of the first record with the key, or nil and -1 if there is none
+// the leaf stays latched until the returned path is released
+// when duplicates are allowed, the run of equal keys can start in the next leaf, so only readers and operations that hold the whole tree can use this
+func (t *Tree[T]) findFirst(val T, mode latchMode) (*node[T], int, *latchPath[T]) {
+	if !t.allowDuplicates {
+		leaf, latches := t.findNode(val, mode)
+		if idx := findItemIndex(leaf, val); idx != -1 {
+			return leaf, idx, latches
+		}
+		return nil, -1, latches
+	}
+
+	for {
+		leaf, idx, latches := t.findNodeAndIdx(val, mode)
+
+		// the run of equal keys can start at the beginning of the next leaf
+		if idx == leaf.numKeys {
+			next, ok := t.nextLeaf(leaf)
+			if !ok {
+				return nil, -1, latches
+			}
+
+			// leaves are latched left to right, against the order of merges, so back off and start over rather than wait
+			if !tryLatchNode(next, mode) {
+				latches.release()
+				continue
+			}
+			latches.moveTo(next)
+			leaf, idx = next, 0
+		}
+
+		if leaf.keys[idx] != val {
+			return nil, -1, latches
+		}
+		return leaf, idx, latches
+	}
 }
 
 // find range of values that satisfy low <= x < high
-func (t *Tree[T]) FindRange(low T, high T) Iterator[T] {
-	// find lower bound
-	lowerNode, lowNodeIdx := t.findNodeAndIdx(
-		low,
-		func(left T, right T) bool {
-			return left >= right
-		},
-	)
+func (t *Tree[T]) FindRange(low T, high T, opts ...ReadOption) Iterator[T] {
+	return t.scan(halfOpen(low, high), opts, false)
+}
 
-	endNode, endNodeIdx := t.findNodeAndIdx(
-		high,
-		func(left T, right T) bool {
-			return left >= right
-		},
-	)
+// find range of values that satisfy low <= x < high, from the highest key down
+// if duplicates are allowed, records with equal keys come in the reverse of the order they were inserted in
+func (t *Tree[T]) FindRangeReverse(high T, low T, opts ...ReadOption) Iterator[T] {
+	return t.scan(halfOpen(low, high), opts, true)
+}
 
-	return &NumIntRecordIterator[T]{
-		IteratorEnd:    endNode,
-		IteratorEndIdx: endNodeIdx,
+// the child at the index of the nonleaf node, fetched, which stops the operation if the pointer is not a node
+func (t *Tree[T]) child(n *node[T], i int) *node[T] {
+	child, ok := t.followChild(n, i)
+	if !ok {
+		corrupt(n, fmt.Sprintf("found a %T in a nonleaf pointer", n.pointers[i]))
+	}
+	return child
+}
 
-		CurrentIdx:   lowNodeIdx,
-		CurrentNode:  lowerNode,
-		isFirstEntry: true,
+// the child at the index of the nonleaf node, fetched, or false if the pointer is not a node
+// on a tree stored in a file, the child points back to the node as its parent from then on, for as long as both are resident
+func (t *Tree[T]) followChild(n *node[T], i int) (*node[T], bool) {
+	child, ok := t.follow(n.pointers[i], n.level-1)
+	if ok && t.store != nil {
+		child.parent = n
 	}
+	return child, ok
+}
 
+// point the child at the index of the nonleaf node back at the node, once it has been moved into it
+// on a tree stored in a file, a child that is not resident is given its parent once it is reached from it instead
+func (t *Tree[T]) adopt(n *node[T], i int) {
+	switch child := n.pointers[i].(type) {
+	case *node[T]:
+		child.parent = n
+	case pageLink:
+		if c, ok := t.store.nodes[uint64(child)]; ok {
+			c.parent = n
+		}
+	default:
+		corrupt(n, fmt.Sprintf("found a %T in a nonleaf pointer", child))
+	}
 }
 
-func (t *Tree[T]) findNodeAndIdx(val T, cmpFunc func(T, T) bool) (*Node[T], int) {
-	node := t.findNode(val)
+// find the left most leaf that could contain the value, and the index of the first key that is not less than it
+// the index is the number of keys in the leaf if every key is less
+func (t *Tree[T]) findNodeAndIdx(val T, mode latchMode) (*node[T], int, *latchPath[T]) {
+	node, latches := t.findLeftmostNode(val, mode)
 
-	if !node.IsLeaf {
-		panic("Found node is not a leaf node")
+	if !node.isLeaf {
+		latches.release()
+		corrupt(node, "found node is not a leaf node")
 	}
 
-	for i := 0; i < node.NumKeys; i++ {
-		if r, ok := node.Pointers[i].(Record[T]); ok {
-			if cmpFunc(r.GetHashableVal(), val) {
-				return node, i
-			}
+	for i := 0; i < node.numKeys; i++ {
+		if node.keys[i] >= val {
+			return node, i, latches
 		}
 	}
 
 	// if all the way at the end, it means that the start / end marker is all the way at the end of the tree
-	return node, node.NumKeys
+	return node, node.numKeys, latches
 }
 
-// if there is a match with the item, return the associated record
-// if there is no match, return nil
-func findItemIndex[T cmp.Ordered](currentNode *Node[T], val T) (Record[T], int) {
-	if !currentNode.IsLeaf {
-		panic("Cannot find insertion index for something that is not a child node")
+// find the right most leaf that could contain the value, and the index of the last key that is not greater than it
+// the index is -1 if every key is greater
+func (t *Tree[T]) findLastAtMost(val T, mode latchMode) (*node[T], int, *latchPath[T]) {
+	// equal keys go to the right of the separator, so this is the right most leaf that can have the key
+	node, latches := t.findNode(val, mode)
+
+	idx := node.numKeys - 1
+	for idx >= 0 && node.keys[idx] > val {
+		idx--
 	}
+	return node, idx, latches
+}
 
-	for i, ptr := range currentNode.Pointers {
-		if record, ok := ptr.(Record[T]); ok && record.GetHashableVal() == val {
-			return record, i
+// if there is a match with the item, return its index
+// if there is no match, return -1
+func findItemIndex[T cmp.Ordered](currentNode *node[T], val T) int {
+	if !currentNode.isLeaf {
+		corrupt(currentNode, "cannot find item index for something that is not a child node")
+	}
+
+	for i, key := range currentNode.keys[:currentNode.numKeys] {
+		if key == val {
+			return i
 		}
 	}
 
-	return nil, -1
+	return -1
 }
 
-func (t *Tree[T]) Delete(val T) bool {
-	// first confirm that the desired value exists
-	targetNode := t.findNode(val)
+// if duplicates are allowed, the first record with the key is deleted
+// if there is none, ErrNotFound is returned, or ErrEmpty if the tree has no records at all
+func (t *Tree[T]) Delete(val T) (err error) {
+	defer t.catchCorrupt(&err)
 
-	// if the value exists, locate its current node,
-	// find the index of the record in the node and remove the value from the node
+	// the first record with the key can be in a leaf outside of the latched path when duplicates are allowed
+	mode := latchDelete
+	if t.allowDuplicates {
+		mode = latchNone
+	}
+	mode, unlock := t.lockTree(mode)
+	defer unlock()
 
-	recordToDelete, recordToDeleteIdxInNode := findItemIndex(targetNode, val)
-	if recordToDelete == nil {
-		return false
+	if !t.writable() {
+		return t.notWritable()
 	}
-	removeKeyAndPointerFromLeaf(targetNode, recordToDeleteIdxInNode)
+	if t.isEmpty() {
+		return ErrEmpty
+	}
+	defer t.commitInto(&err)
+	defer t.validateChange("Delete", val)()
 
-	if t.Root == targetNode {
-		return true
+	if t.deleteKey(val, mode) == nil {
+		return notFound(val)
 	}
+	return nil
+}
 
-	if targetNode.NumKeys >= MIN_LEAF_KEYS {
-		return true
+// delete the first record with the key from a tree that is already locked, with the mode it was locked in
+// the deleted record is returned, or nil if the key was not present
+func (t *Tree[T]) deleteKey(val T, mode latchMode) Record[T] {
+	// first confirm that the desired value exists
+	// if the value exists, locate its current node and the index of the record in the node
+	targetNode, recordToDeleteIdxInNode, latches := t.findFirst(val, mode)
+	defer latches.release()
+	if targetNode == nil {
+		return nil
 	}
 
-	targetNodeIdxInParent := -1
-	// in a non-leaf node, the number of pointers is equal to numKeys + 1
-	for i := 0; i < targetNode.Parent.NumKeys+1; i++ {
-		if targetNode.Parent.Pointers[i] == targetNode {
-			targetNodeIdxInParent = i
-			break
-		}
+	deleted := t.recordAt(targetNode, recordToDeleteIdxInNode, latestVersion)
+	if !t.deleteAt(targetNode, recordToDeleteIdxInNode) {
+		return nil
+	}
+	return deleted
+}
+
+// remove the record at the index from the leaf, and rebalance the tree if the leaf gets too small
+func (t *Tree[T]) deleteFromLeaf(targetNode *node[T], recordToDeleteIdxInNode int) {
+	removeKeyAndPointerFromLeaf(targetNode, recordToDeleteIdxInNode)
+	t.markDirty(targetNode)
+
+	if targetNode.numKeys >= t.minLeafKeys {
+		t.summarizeUp(targetNode)
+		return
+	}
+
+	// the parent pointer is only safe to read once the node is known to be short of keys,
+	// since only then is the parent latched as well
+	if targetNode.parent == nil {
+		t.summarize(targetNode)
+		return
 	}
 
+	targetNodeIdxInParent := t.getNodeIndexInParent(targetNode, targetNode.parent)
 	if targetNodeIdxInParent == -1 {
-		panic("Could not find index of node in parent")
+		corrupt(targetNode, "could not find index of node in parent")
 	}
 
 	t.deleteCleanup(targetNode, targetNodeIdxInParent)
-	return true
 }
 
-func (t *Tree[T]) deleteFromNonLeaf(targetNode *Node[T], targetNodeIdxInParent int) {
+func (t *Tree[T]) deleteFromNonLeaf(targetNode *node[T], targetNodeIdxInParent int) {
 	removeKeyAndPointerFromNonLeaf(targetNode, targetNodeIdxInParent)
+	t.markDirty(targetNode)
 
-	if targetNode.NumKeys >= MIN_NONLEAF_KEYS {
+	// the minimum is always at least one key, so this holds for the root as well
+	// the parent pointer is only safe to read past this point, since only then is the parent latched as well
+	if targetNode.numKeys >= t.minNonLeafKeys {
+		t.summarizeUp(targetNode)
 		return
 	}
 
-	// handle the case where the node that just had its key removed is its parent
-	// if the parent node has less than the min non-leaf keys, it must mean that there is only one child left
+	// handle the case where the node that just had its key removed is the root
+	// the root is allowed to go below the minimum, but once it only has one child left, that child becomes the root
 	// by design, it is always the left most child
-	if targetNode.Parent == nil {
-		if node, ok := targetNode.Pointers[0].(*Node[T]); ok {
-			t.Root = node
+	if targetNode.parent == nil {
+		if targetNode.numKeys > 0 {
+			t.summarize(targetNode)
+			return
 		}
+		node := t.child(targetNode, 0)
+		node.parent = nil
+		t.root = node
+		t.freeNode(targetNode)
 		return
 	}
 
 	// after removal, recalculate the idx
-	targetNodeIdxInParent = -1
-	for i := 0; i <= targetNode.Parent.NumKeys; i++ {
-		if targetNode.Parent.Pointers[i] == targetNode {
-			targetNodeIdxInParent = i
-			break
-		}
-	}
+	targetNodeIdxInParent = t.getNodeIndexInParent(targetNode, targetNode.parent)
 	if targetNodeIdxInParent == -1 {
-		panic("Could not find node in parent")
+		corrupt(targetNode, "could not find node in parent")
 	}
 
 	t.deleteCleanup(targetNode, targetNodeIdxInParent)
 }
 
-func (t *Tree[T]) deleteCleanup(targetNode *Node[T], targetNodeIdxInParent int) {
-	var neighborNodeIdx, separatorKeyIdx int
-	var separator T
-	var neighborNode *Node[T]
+func (t *Tree[T]) deleteCleanup(targetNode *node[T], targetNodeIdxInParent int) {
+	neighborNode, neighborNodeIdx, separatorKeyIdx := t.neighborOf(targetNode, targetNodeIdxInParent)
+	separator := targetNode.parent.keys[separatorKeyIdx]
+
+	// the parent is latched, so nothing else can be on its way down to the neighbor
+	// scans that are already in it back off rather than wait for the target, so this cannot deadlock
+	neighborNode.latch.Lock()
+	defer neighborNode.latch.Unlock()
 
+	if targetNode.numKeys+neighborNode.numKeys <= t.mergedCapacity(targetNode) {
+		if targetNodeIdxInParent != 0 {
+			t.coalesce(neighborNode, targetNode, targetNodeIdxInParent, targetNode.parent, separator)
+		} else {
+			t.coalesce(targetNode, neighborNode, neighborNodeIdx, targetNode.parent, separator)
+		}
+
+		return
+	}
+
+	// redistribution always goes left to right, so pass the neighbor first if it is on the left
+	t.markDirty(targetNode, neighborNode, targetNode.parent)
+	if targetNodeIdxInParent != 0 {
+		t.redistributeNodes(neighborNode, targetNode, targetNode.parent, targetNodeIdxInParent, separatorKeyIdx)
+	} else {
+		t.redistributeNodes(targetNode, neighborNode, targetNode.parent, targetNodeIdxInParent, separatorKeyIdx)
+	}
+	t.summarize(targetNode)
+	t.summarize(neighborNode)
+	t.summarizeUp(targetNode.parent)
+}
+
+// the sibling that a node short of keys takes keys from or is merged with, which is the one on its left unless it is the left most child
+// along with the node, this returns its index in the parent and the index of the separator between the two
+func (t *Tree[T]) neighborOf(targetNode *node[T], targetNodeIdxInParent int) (*node[T], int, int) {
+	var neighborNodeIdx, separatorKeyIdx int
 	if targetNodeIdxInParent != 0 {
 		neighborNodeIdx = targetNodeIdxInParent - 1
 		separatorKeyIdx = neighborNodeIdx
@@ -447,164 +1058,190 @@ func (t *Tree[T]) deleteCleanup(targetNode *Node[T], targetNodeIdxInParent int)
 		separatorKeyIdx = 0
 	}
 
-	if nbn, ok := targetNode.Parent.Pointers[neighborNodeIdx].(*Node[T]); ok {
-		neighborNode = nbn
-		separator = targetNode.Parent.Keys[separatorKeyIdx]
-	} else {
-		panic(fmt.Sprintf("Neighbor node was invalid: %T", targetNode.Parent.Pointers[neighborNodeIdx]))
-	}
+	return t.unshare(t.child(targetNode.parent, neighborNodeIdx)), neighborNodeIdx, separatorKeyIdx
+}
 
-	if targetNode.NumKeys+neighborNode.NumKeys <= MAX_KEYS_PER_NODE {
-		if targetNodeIdxInParent != 0 {
-			t.coalesce(neighborNode, targetNode, targetNodeIdxInParent, targetNode.Parent, separator)
-		} else {
-			t.coalesce(targetNode, neighborNode, neighborNodeIdx, targetNode.Parent, separator)
-		}
+// the most keys two neighbors can have between them to be merged into one node
+func (t *Tree[T]) mergedCapacity(n *node[T]) int {
+	// when two nonleaf nodes are merged, the separator comes down into the merged node as well
+	if !n.isLeaf {
+		return t.maxKeysPerNode - 1
+	}
+	return t.maxKeysPerNode
+}
 
-		return
+func removeKeyAndPointerFromLeaf[T cmp.Ordered](node *node[T], recordToDeleteIdx int) {
+	for i := recordToDeleteIdx; i < node.numKeys-1; i++ {
+		node.keys[i] = node.keys[i+1]
+		node.pointers[i] = node.pointers[i+1]
 	}
 
-	redistributeNodes(targetNode, neighborNode, targetNode.Parent, targetNodeIdxInParent, separatorKeyIdx)
+	node.numKeys--
+	node.pointers[node.numKeys] = nil
 }
 
-func removeKeyAndPointerFromLeaf[T cmp.Ordered](node *Node[T], recordToDeleteIdx int) {
-	for i := recordToDeleteIdx; i < node.NumKeys-1; i++ {
-		node.Keys[i] = node.Keys[i+1]
-		node.Pointers[i] = node.Pointers[i+1]
+func removeKeyAndPointerFromNonLeaf[T cmp.Ordered](node *node[T], targetNodeIdxInParent int) {
+	// stop at numKeys here since targetNodeIdx is the pointer index and the total number of pointers == node.numKeys
+	for i := targetNodeIdxInParent; i < node.numKeys; i++ {
+		node.keys[i-1] = node.keys[i]
+		node.pointers[i] = node.pointers[i+1]
 	}
 
-	node.NumKeys--
+	node.pointers[node.numKeys] = nil
+	node.numKeys--
 }
 
-func removeKeyAndPointerFromNonLeaf[T cmp.Ordered](node *Node[T], targetNodeIdxInParent int) {
-	// stop at NumKeys here since targetNodeIdx is the pointer index and the total number of pointers == node.NumKeys
-	for i := targetNodeIdxInParent; i < node.NumKeys; i++ {
-		node.Keys[i-1] = node.Keys[i]
-		node.Pointers[i] = node.Pointers[i+1]
-	}
+func (t *Tree[T]) coalesce(left *node[T], right *node[T], rightIdx int, parent *node[T], separator T) {
+	t.merge(left, right, separator)
 
-	node.NumKeys--
+	// now remove the right side from the parent node
+	t.deleteFromNonLeaf(parent, rightIdx)
+	t.validateStep("merge in coalesce")
 }
 
-func (t *Tree[T]) coalesce(left *Node[T], right *Node[T], rightIdx int, parent *Node[T], separator T) {
+// move every entry of the right node into the left node, and free the right node
+// the right node is left in its parent, which the caller removes it from
+func (t *Tree[T]) merge(left *node[T], right *node[T], separator T) {
 	// move all records that were in the right node into the left node
 
 	// if it was a leaf, just copy directly
-	if left.IsLeaf {
-		for i, j := left.NumKeys, 0; j < right.NumKeys; i, j = i+1, j+1 {
-			left.Keys[i] = right.Keys[j]
-			left.Pointers[i] = right.Pointers[j]
-			left.NumKeys++
+	if left.isLeaf {
+		for i, j := left.numKeys, 0; j < right.numKeys; i, j = i+1, j+1 {
+			left.keys[i] = right.keys[j]
+			left.pointers[i] = right.pointers[j]
+			left.numKeys++
 		}
 
 		// set up for the removal of the right entry from the linked list
-		left.Pointers[MAX_LEAF_POINTERS] = right.Pointers[MAX_LEAF_POINTERS]
+		left.pointers[t.maxLeafPointers] = right.pointers[t.maxLeafPointers]
+		t.linkBack(left)
 	} else {
-		left.Keys[left.NumKeys] = separator
-		left.NumKeys++
-		for i, j := left.NumKeys, 0; j < right.NumKeys; i, j = i+1, j+1 {
-			left.Keys[i] = right.Keys[j]
-			left.Pointers[i] = right.Pointers[j]
-
-			// adjust them all to point to the same parent
-			if l, ok := left.Pointers[i].(*Node[T]); left.Pointers[i] != nil && ok {
-				l.Parent = left.Parent
-			} else {
-				panic("Did not insert a node")
+		left.keys[left.numKeys] = separator
+		left.numKeys++
+		for i, j := left.numKeys, 0; j <= right.numKeys; i, j = i+1, j+1 {
+			// there is always one more pointer than key
+			if j < right.numKeys {
+				left.keys[i] = right.keys[j]
 			}
+			left.pointers[i] = right.pointers[j]
 
-			left.NumKeys++
+			// adjust them all to point to their new parent
+			t.adopt(left, i)
 		}
-
-		// copy over the final pointer
-		left.Pointers[left.NumKeys] = right.Pointers[right.NumKeys]
+		left.numKeys += right.numKeys
 	}
 
-	// now remove the right side from the parent node
-	t.deleteFromNonLeaf(parent, rightIdx)
+	t.markDirty(left)
+	t.summarize(left)
+	t.freeNode(right)
 }
 
-func redistributeNodes[T cmp.Ordered](left *Node[T], right *Node[T], parent *Node[T], targetNodeIdx int, separatorIdx int) {
-	if left.IsLeaf {
+// moves a single entry between two neighbors under the same parent
+// if targetNodeIdx is 0, the left node is the one short of entries, otherwise it is the right node
+func (t *Tree[T]) redistributeNodes(left *node[T], right *node[T], parent *node[T], targetNodeIdx int, separatorIdx int) {
+	if left.isLeaf {
 		// if left node is the one that needs more entries
 		// put the first entry of the right into the left
 		if targetNodeIdx == 0 {
-			left.Keys[left.NumKeys] = right.Keys[0]
-			left.Pointers[left.NumKeys] = right.Pointers[0]
-			left.NumKeys++
+			left.keys[left.numKeys] = right.keys[0]
+			left.pointers[left.numKeys] = right.pointers[0]
+			left.numKeys++
 
 			// move all entries up
-			for i := 1; i < right.NumKeys; i++ {
-				right.Keys[i-1] = right.Keys[i]
-				right.Pointers[i-1] = right.Pointers[i]
+			for i := 1; i < right.numKeys; i++ {
+				right.keys[i-1] = right.keys[i]
+				right.pointers[i-1] = right.pointers[i]
 			}
-			right.NumKeys--
+			right.numKeys--
+			right.pointers[right.numKeys] = nil
 		} else { // put the last entry of the left into the right
-			// shift the right keys forward
-			for i := 0; i <= right.NumKeys; i++ {
-				right.Keys[i+1] = right.Keys[i]
-				right.Pointers[i+1] = right.Pointers[i]
+			// shift the right keys back, starting from the end so that nothing is overwritten
+			for i := right.numKeys; i > 0; i-- {
+				right.keys[i] = right.keys[i-1]
+				right.pointers[i] = right.pointers[i-1]
 			}
-			right.NumKeys++
+			right.numKeys++
 
-			right.Keys[0] = left.Keys[left.NumKeys-1]
-			right.Pointers[0] = left.Pointers[left.NumKeys-1]
-			left.NumKeys--
+			right.keys[0] = left.keys[left.numKeys-1]
+			right.pointers[0] = left.pointers[left.numKeys-1]
+			left.numKeys--
+			left.pointers[left.numKeys] = nil
 		}
 
 		// adjust the separator on top
-		parent.Keys[separatorIdx] = right.Keys[0]
+		parent.keys[separatorIdx] = right.keys[0]
 	} else {
-		// TODO: untested
 		if targetNodeIdx == 0 { // move the key into the left node
-			left.Keys[left.NumKeys] = parent.Keys[separatorIdx]
-			left.NumKeys++
-			left.Pointers[left.NumKeys] = right.Pointers[0]
+			left.keys[left.numKeys] = parent.keys[separatorIdx]
+			left.numKeys++
+			left.pointers[left.numKeys] = right.pointers[0]
+			t.adopt(left, left.numKeys)
 
-			parent.Keys[separatorIdx] = right.Keys[0]
+			parent.keys[separatorIdx] = right.keys[0]
 
-			for i := 1; i < right.NumKeys; i++ {
-				right.Keys[i-1] = right.Keys[i]
-				right.Pointers[i-1] = right.Pointers[i]
+			for i := 1; i < right.numKeys; i++ {
+				right.keys[i-1] = right.keys[i]
 			}
-			// move the last pointer over, since there is always one more pointer than key
-			right.Pointers[right.NumKeys] = right.Pointers[right.NumKeys+1]
-			right.NumKeys--
+			// there is always one more pointer than key
+			for i := 1; i <= right.numKeys; i++ {
+				right.pointers[i-1] = right.pointers[i]
+			}
+			right.pointers[right.numKeys] = nil
+			right.numKeys--
 		} else {
-			// move all the right items one position forward
-			for i := 0; i < right.NumKeys; i++ {
-				right.Keys[i+1] = right.Keys[i]
-				right.Pointers[i+1] = right.Pointers[i]
+			// move all the right items one position back, starting from the end so that nothing is overwritten
+			// the last pointer moves as well, since there is always one more pointer than key
+			right.pointers[right.numKeys+1] = right.pointers[right.numKeys]
+			for i := right.numKeys; i > 0; i-- {
+				right.keys[i] = right.keys[i-1]
+				right.pointers[i] = right.pointers[i-1]
 			}
-			// move the last pointer as well
-			right.Pointers[right.NumKeys+1] = right.Pointers[right.NumKeys]
 
-			right.Keys[0] = parent.Keys[separatorIdx]
-			right.Pointers[0] = left.Pointers[left.NumKeys]
-			right.NumKeys++
+			right.keys[0] = parent.keys[separatorIdx]
+			right.pointers[0] = left.pointers[left.numKeys]
+			t.adopt(right, 0)
+			right.numKeys++
 
-			parent.Keys[separatorIdx] = left.Keys[left.NumKeys-1]
-			left.NumKeys--
+			parent.keys[separatorIdx] = left.keys[left.numKeys-1]
+			left.pointers[left.numKeys] = nil
+			left.numKeys--
 		}
 	}
 }
 
 // struct for printing
 type nodeWithDepth[T cmp.Ordered] struct {
-	*Node[T]
-	Depth int
+	*node[T]
+	depth int
+}
+
+// a tree that cannot be read, such as one whose file fails to read a node, is shown as the error instead
+func (t *Tree[T]) String() (treeString string) {
+	var err error
+	defer func() {
+		if err != nil {
+			treeString = err.Error()
+		}
+	}()
+	defer t.catchCorrupt(&err)
+
+	_, unlock := t.lockTree(latchNone)
+	defer unlock()
+
+	return t.string()
 }
 
-func (t *Tree[T]) String() string {
+func (t *Tree[T]) string() string {
 	treeString := ""
 
-	if t.Root == nil {
+	if t.root == nil {
 		return ""
 	}
+	defer t.release()
 
 	queue := make([]*nodeWithDepth[T], 1)
 	queue[0] = &nodeWithDepth[T]{
-		t.Root,
+		t.root,
 		0,
 	}
 
@@ -612,27 +1249,28 @@ func (t *Tree[T]) String() string {
 	for len(queue) > 0 {
 		top := queue[0]
 		queue = queue[1:]
+		t.fetch(top.node)
 
-		if top.Depth > currentDepth {
+		if top.depth > currentDepth {
 			treeString += "\n"
-			currentDepth = top.Depth
-		} else if top.Depth < currentDepth {
+			currentDepth = top.depth
+		} else if top.depth < currentDepth {
 			panic("Did not BFS")
 		}
 
 		// if not a leaf, print the keys
-		if !top.IsLeaf {
-			for i := range top.NumKeys + 1 {
-				if i < top.NumKeys {
-					treeString += fmt.Sprintf("%v ", top.Keys[i])
+		if !top.isLeaf {
+			for i := range top.numKeys + 1 {
+				if i < top.numKeys {
+					treeString += fmt.Sprintf("%v ", top.keys[i])
 
 				}
-				if childNode, ok := top.Pointers[i].(*Node[T]); ok {
+				if childNode, ok := t.follow(top.pointers[i], top.level-1); ok {
 					queue = append(
 						queue,
 						&nodeWithDepth[T]{
 							childNode,
-							top.Depth + 1,
+							top.depth + 1,
 						},
 					)
 				}
@@ -640,11 +1278,10 @@ func (t *Tree[T]) String() string {
 			}
 
 		} else { // if is a leaf, print the values
-			for i := range top.NumKeys {
-				if formattedRecord, ok := top.Pointers[i].(Record[T]); ok {
+			for i := range top.numKeys {
+				// keys that were deleted in the latest version are left out
+				if formattedRecord := t.recordAt(top.node, i, latestVersion); formattedRecord != nil {
 					treeString += formattedRecord.String() + " "
-				} else {
-					fmt.Printf("Could not format into a record\n")
 				}
 			}
 		}
@@ -1,4 +1,4 @@
-package main
+package bptree
 
 import (
 	"cmp"
@@ -32,42 +32,115 @@ func (n *NumRecord) String() string {
 type Iterator[T cmp.Ordered] interface {
 	// bool field tells you if there is a next value
 	Next() Record[T]
+	// the error that ended the iteration early, such as a failure to read a node of a tree stored in a file,
+	// or nil if it ran out of records
+	Err() error
 }
 
-type NumIntRecordIterator[T cmp.Ordered] struct {
-	// give a *Node[T] and int so that you dont run into the edge case where the end record is nil
-	IteratorEnd    *Node[T]
-	IteratorEndIdx int
+// walks the records in the range from one end, until a key is past the other end of it
+//
+// no latch is held in between calls, since an iterator can be dropped at any point
+// instead, the iterator keeps a cursor at the last record it returned, which finds its place again by key if the leaf has changed since
+type rangeIterator[T cmp.Ordered] struct {
+	// not at any record until the first one is returned
+	cursor Cursor[T]
 
-	CurrentIdx   int
-	CurrentNode  *Node[T]
-	isFirstEntry bool
-	takeLast     bool
+	keys KeyRange[T]
+	// whether the iterator walks from the end of the range down
+	reverse bool
+	done    bool
+	// the failure that ended the iteration early
+	err error
 }
 
-func (n *NumIntRecordIterator[T]) Next() Record[T] {
-	if !n.isFirstEntry {
-		n.CurrentIdx++
-	} else {
-		n.isFirstEntry = false
+// start an iterator at the first key in the range, or at the last key if it walks the range in reverse
+// the tree has to be locked already
+func (t *Tree[T]) newRangeIterator(keys KeyRange[T], asOf uint64, reverse bool) (n *rangeIterator[T]) {
+	n = &rangeIterator[T]{
+		cursor:  Cursor[T]{tree: t, asOf: asOf},
+		keys:    keys,
+		reverse: reverse,
 	}
-	// if you have reached the next pointer
-	if n.CurrentIdx == n.CurrentNode.NumKeys && n.CurrentNode != n.IteratorEnd {
-		if node, ok := n.CurrentNode.Pointers[MAX_LEAF_POINTERS].(*Node[T]); ok {
-			n.CurrentNode = node
-			n.CurrentIdx = 0
-		} else if n.CurrentNode.Pointers[MAX_LEAF_POINTERS] == nil { // this is in the case that the end of the tree's leaves was reached
-			return nil
-		}
+	defer t.catchCorrupt(&n.err)
+	t.checkVersion(asOf)
+
+	// there is nothing to walk in an empty tree, even once records are inserted into it
+	n.done = t.isEmpty()
+	return n
+}
+
+func (n *rangeIterator[T]) Next() Record[T] {
+	if n.done || n.err != nil {
+		return nil
 	}
 
-	if n.CurrentNode != n.IteratorEnd || n.IteratorEndIdx != n.CurrentIdx {
-		if r, ok := n.CurrentNode.Pointers[n.CurrentIdx].(Record[T]); ok {
-			return r
-		} else {
-			panic("Could not cast into a record")
+	c := &n.cursor
+	t := c.tree
+	defer t.catchCorrupt(&n.err)
+	mode, unlock := t.lockTree(latchRead)
+	defer unlock()
+	defer t.release()
+	t.checkVersion(c.asOf)
+
+	if t.isEmpty() || !c.walk(mode, n.step) || !n.keys.Contains(c.key) {
+		n.done = true
+		return nil
+	}
+	return c.record
+}
+
+func (n *rangeIterator[T]) Err() error {
+	return n.err
+}
+
+// walk to the record after the last one returned, or to the first record in the range if none has been returned yet
+func (n *rangeIterator[T]) step(w *leafWalk[T]) walkResult {
+	c := &n.cursor
+	switch {
+	case c.valid && n.reverse:
+		return c.before(w)
+	case c.valid:
+		return c.after(w)
+	case n.reverse:
+		switch n.keys.High.kind {
+		case inclusive:
+			return w.floor(n.keys.High.key)
+		case exclusive:
+			return w.lower(n.keys.High.key)
 		}
-	} else {
+		return w.last()
+	}
+
+	switch n.keys.Low.kind {
+	case inclusive:
+		return w.ceiling(n.keys.Low.key)
+	case exclusive:
+		return w.higher(n.keys.Low.key)
+	}
+	return w.first()
+}
+
+// NewSliceIterator iterates over the records in the slice, in order
+func NewSliceIterator[T cmp.Ordered](records []Record[T]) Iterator[T] {
+	return &sliceIterator[T]{
+		records: records,
+	}
+}
+
+type sliceIterator[T cmp.Ordered] struct {
+	records []Record[T]
+}
+
+func (s *sliceIterator[T]) Next() Record[T] {
+	if len(s.records) == 0 {
 		return nil
 	}
+
+	record := s.records[0]
+	s.records = s.records[1:]
+	return record
+}
+
+func (s *sliceIterator[T]) Err() error {
+	return nil
 }
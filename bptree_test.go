@@ -1,8 +1,11 @@
-package main
+package bptree
 
 import (
+	"errors"
+	"math/rand"
 	"reflect"
 	"slices"
+	"strings"
 	"testing"
 )
 
@@ -53,7 +56,7 @@ func TestTreeLookup(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		record := tree.FindPoint(test.val.GetHashableVal())
+		record, _ := tree.FindPoint(test.val.GetHashableVal())
 
 		if test.isNotNil {
 			if record == nil {
@@ -131,6 +134,59 @@ func TestDeletionAndRangeLookup(t *testing.T) {
 	}
 }
 
+func TestTreeReverseRangeLookup(t *testing.T) {
+	tree := NewTree[int](WithOrder(3))
+	for val := 1; val <= 10; val++ {
+		tree.Insert(NewIntRecord(val))
+	}
+	tree.Delete(6)
+
+	var tests = []struct {
+		high   int
+		low    int
+		intArr []int
+	}{
+		{6, 2, []int{5, 4, 3, 2}},
+		{20, 6, []int{10, 9, 8, 7}},
+		{11, -5, []int{10, 9, 8, 7, 5, 4, 3, 2, 1}},
+		{1, -5, []int{}},
+		{7, 6, []int{}},
+	}
+
+	for _, test := range tests {
+		if rangeRes := collectKeys(tree.FindRangeReverse(test.high, test.low)); !slices.Equal(test.intArr, rangeRes) {
+			t.Errorf("Expected: %+v, Got: %+v\n", test.intArr, rangeRes)
+		}
+	}
+}
+
+func TestLeafLinksAfterRandomChanges(t *testing.T) {
+	for _, order := range []int{3, 4, 7} {
+		tree := NewTree[int](WithOrder(order), WithDuplicates())
+		r := rand.New(rand.NewSource(int64(order)))
+
+		for range 2000 {
+			val := r.Intn(200)
+			// a key that is not there is inserted instead
+			if r.Intn(3) == 0 && tree.Delete(val) == nil {
+				continue
+			}
+			tree.Insert(NewIntRecord(val))
+		}
+		checkLeafLinks(t, tree)
+
+		for range 20 {
+			low := r.Intn(200)
+			high := low + r.Intn(50)
+			expected := collectKeys(tree.FindRange(low, high))
+			slices.Reverse(expected)
+			if keys := collectKeys(tree.FindRangeReverse(high, low)); !slices.Equal(keys, expected) {
+				t.Errorf("Order %d: expected the reverse of [%d, %d):\nExpected: %v\nGot: %v", order, low, high, expected, keys)
+			}
+		}
+	}
+}
+
 func TestTreeDeletion(t *testing.T) {
 	tree := NewTree[int]()
 	vals := []int{10, 4, 5, 7, 8, 1, 2, 6, 3, 9, 11, 12}
@@ -152,7 +208,7 @@ func TestTreeDeletion(t *testing.T) {
 
 	for _, test := range tests {
 		recordToDelete := NewIntRecord(test.toDelete)
-		exists := tree.Delete(recordToDelete.GetHashableVal())
+		exists := tree.Delete(recordToDelete.GetHashableVal()) == nil
 
 		if exists != test.exists {
 			t.Errorf("Expected target's existence to be: %v, but got: %v, when node to delete was: %v\n", test.exists, exists, recordToDelete)
@@ -181,13 +237,148 @@ func TestFindInsertionIndex(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		customTree.Root.Keys = test.keys
-		customTree.Root.NumKeys = len(customTree.Root.Keys)
+		customTree.root.keys = test.keys
+		customTree.root.numKeys = len(customTree.root.keys)
 
-		insertionIndex := findInsertionIndex(customTree.Root, test.recordToInsert)
+		insertionIndex := findInsertionIndex(customTree.root, test.recordToInsert)
 		if insertionIndex != test.expectedIndex {
 			t.Errorf("Did not find the correct insertion node in pointers")
 		}
 	}
 
 }
+
+// trees with different orders should be able to live side by side without affecting each other
+func TestTreeOrders(t *testing.T) {
+	orders := []int{3, 4, 5, 8, 256}
+	trees := make([]*Tree[int], len(orders))
+	for i, order := range orders {
+		trees[i] = NewTree[int](WithOrder(order))
+	}
+
+	r := rand.New(rand.NewSource(1))
+	expected := make(map[int]bool)
+	for range 5000 {
+		val := r.Intn(1000)
+		remove := r.Intn(3) == 0 && len(expected) > 0
+
+		for _, tree := range trees {
+			if remove {
+				if exists := tree.Delete(val) == nil; exists != expected[val] {
+					t.Fatalf("Expected existence of %d in tree of order %d to be %v", val, tree.Order(), expected[val])
+				}
+			} else {
+				tree.Insert(NewIntRecord(val))
+			}
+		}
+
+		if remove {
+			delete(expected, val)
+		} else {
+			expected[val] = true
+		}
+	}
+
+	expectedArr := make([]int, 0, len(expected))
+	for val := range expected {
+		expectedArr = append(expectedArr, val)
+	}
+	slices.Sort(expectedArr)
+
+	for _, tree := range trees {
+		rangeRes := make([]int, 0)
+		record := tree.FindRange(-1, 1000)
+		for rec := record.Next(); rec != nil; rec = record.Next() {
+			rangeRes = append(rangeRes, rec.GetHashableVal())
+		}
+
+		if !slices.Equal(expectedArr, rangeRes) {
+			t.Errorf("Tree of order %d has the wrong contents:\nExpected: %+v\nGot: %+v\n", tree.Order(), expectedArr, rangeRes)
+		}
+	}
+}
+
+func TestWithMaxKeysPerNode(t *testing.T) {
+	tree := NewTree[int](WithMaxKeysPerNode(2))
+	for _, val := range []int{1, 2, 3} {
+		tree.Insert(NewIntRecord(val))
+	}
+
+	if tree.Order() != 3 {
+		t.Errorf("Expected order 3, got %d", tree.Order())
+	}
+	if tree.String() != "3 |\n1 2 |3 |" {
+		t.Errorf("Format incorrect:\ngot:\n%s\n", tree.String())
+	}
+}
+
+// a record type with a payload, so that swapped records can be told apart
+type labelledRecord struct {
+	key   int
+	label string
+}
+
+func (r *labelledRecord) GetHashableVal() int {
+	return r.key
+}
+
+func (r *labelledRecord) String() string {
+	return r.label
+}
+
+func TestTreeInsertReportsInsertion(t *testing.T) {
+	tree := NewTree[int]()
+
+	if err := tree.Insert(&labelledRecord{1, "first"}); err != nil {
+		t.Errorf("Expected the first insertion of 1 to succeed, got %v", err)
+	}
+	if err := tree.Insert(&labelledRecord{1, "second"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected the second insertion of 1 to be rejected, got %v", err)
+	}
+	if record, _ := tree.FindPoint(1); record.String() != "first" {
+		t.Errorf("Expected the original record to be kept, got %v", record)
+	}
+}
+
+func TestTreeUpsertAndReplace(t *testing.T) {
+	tree := NewTree[int]()
+
+	if previous, err := tree.Replace(&labelledRecord{1, "a"}); previous != nil || !errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected replace on an empty tree to return ErrEmpty, got %v and %v", previous, err)
+	}
+
+	for i := range 10 {
+		if previous, _ := tree.Upsert(&labelledRecord{i, "a"}); previous != nil {
+			t.Errorf("Expected upsert of new key %d to return nil, got %v", i, previous)
+		}
+	}
+	structure := tree.String()
+
+	if previous, _ := tree.Upsert(&labelledRecord{3, "b"}); previous == nil || previous.String() != "a" {
+		t.Errorf("Expected upsert of 3 to return the previous record, got %v", previous)
+	}
+	if previous, _ := tree.Replace(&labelledRecord{7, "c"}); previous == nil || previous.String() != "a" {
+		t.Errorf("Expected replace of 7 to return the previous record, got %v", previous)
+	}
+	if previous, err := tree.Replace(&labelledRecord{20, "c"}); previous != nil || !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected replace of a missing key to return ErrNotFound, got %v and %v", previous, err)
+	}
+	if record, err := tree.FindPoint(20); record != nil || !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected replace to not insert missing keys, found %v", record)
+	}
+
+	three, _ := tree.FindPoint(3)
+	seven, _ := tree.FindPoint(7)
+	if three.String() != "b" || seven.String() != "c" {
+		t.Errorf("Expected the records to be swapped, got %v and %v", three, seven)
+	}
+
+	// swapping records in place should not change the shape of the tree
+	// the records are printed by label, so compare the keys of the nonleaf levels only
+	nonLeafLevels := func(treeString string) string {
+		return treeString[:strings.LastIndex(treeString, "\n")]
+	}
+	if nonLeafLevels(tree.String()) != nonLeafLevels(structure) {
+		t.Errorf("Expected the tree's structure to be unchanged:\nbefore:\n%s\nafter:\n%s\n", structure, tree.String())
+	}
+}
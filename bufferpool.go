@@ -0,0 +1,217 @@
+package bptree
+
+import (
+	"cmp"
+	"container/list"
+	"fmt"
+	"unsafe"
+)
+
+// how much memory the nodes of a tree opened with Open can take up, unless WithMemoryBudget is given
+const DEFAULT_MEMORY_BUDGET = 64 << 20
+
+// WithMemoryBudget sets how many bytes of pages a tree opened with Open keeps in memory
+//
+// Nodes are read from the file as they are needed, and the least recently used ones are dropped once the budget is used up,
+// so a tree can be much larger than the memory it is given
+// The budget is counted in whole pages, along with what it takes to keep track of each of them,
+// and is only exceeded while a single operation needs more nodes than fit in it
+func WithMemoryBudget(bytes int64) TreeOption {
+	return func(o *treeOptions) {
+		o.memoryBudget = bytes
+	}
+}
+
+// keeps a bounded number of nodes in memory, for trees stored in a file
+//
+// nodes link to their children and to the next leaf by page id, so a node that is evicted is dropped altogether,
+// and is read into a new node the next time a link to it is followed
+// a node only points to its parent while both are resident, which is always the case on the path an operation took down the tree,
+// and there are no links back between the leaves, so the leaf before a leaf is found through its parents as well
+// a node that is fetched is pinned until the operation that fetched it is done, and cannot be evicted until then
+// the root is never evicted, since every operation starts from it
+type bufferPool[T cmp.Ordered] struct {
+	// how many bytes the resident nodes can take up, where each takes up a page
+	budget   int64
+	pageSize int64
+	// what keeping track of a resident node takes up besides its page, which is the node itself and its entry in the map of nodes by page id
+	nodeSize int64
+
+	// the resident nodes, from the most to the least recently used
+	lru *list.List
+	// the nodes pinned by the operation in progress, once for every time they were fetched
+	pinned []*node[T]
+}
+
+func newBufferPool[T cmp.Ordered](memoryBudget int64, pageSize int) bufferPool[T] {
+	return bufferPool[T]{
+		budget:   memoryBudget,
+		pageSize: int64(pageSize),
+		nodeSize: int64(unsafe.Sizeof(node[T]{})) + 2*int64(unsafe.Sizeof(uintptr(0))),
+		lru:      list.New(),
+	}
+}
+
+// whether the resident nodes take up more than the budget, while more than one node is resident
+func (p *bufferPool[T]) overBudget() bool {
+	resident := int64(p.lru.Len())
+	return resident > 1 && resident*(p.pageSize+p.nodeSize) > p.budget
+}
+
+// a link from a node of a tree stored in a file to one of its children or to the next leaf, which is the page id of the node it links to
+type pageLink uint64
+
+// what a node links to the node with, which is the node itself on trees that only live in memory
+func (t *Tree[T]) link(n *node[T]) any {
+	if t.store == nil {
+		return n
+	}
+	return pageLink(n.pageID)
+}
+
+// the node that a pointer of a nonleaf node, or the last pointer of a leaf, links to, fetched, or false if the pointer is not a link
+// on a tree stored in a file, a node that is not resident is read from its page, which has to be on the level the link is from,
+// counted as the number of levels above the leaves
+func (t *Tree[T]) follow(ptr any, level int) (*node[T], bool) {
+	s := t.store
+	if s == nil {
+		n, ok := ptr.(*node[T])
+		return n, ok
+	}
+
+	link, ok := ptr.(pageLink)
+	if !ok {
+		return nil, false
+	}
+
+	// a closed tree has no file to read nodes from, so it turns away reads as well as changes
+	if s.file == nil {
+		panic(ErrClosed)
+	}
+	n, err := s.node(t, uint64(link), level)
+	if err != nil {
+		// whatever operation was in progress cannot finish, and the tree cannot be trusted to take any more changes
+		s.err = fmt.Errorf("bptree: could not load a node, reopen the tree to recover: %w", err)
+		panic(s.err)
+	}
+	return t.fetch(n), true
+}
+
+// the node stored in the page, which is read from the file unless it is resident already
+func (s *pageStore[T]) node(t *Tree[T], pageID uint64, level int) (*node[T], error) {
+	n, ok := s.nodes[pageID]
+	if !ok {
+		return s.load(t, pageID, level)
+	}
+	if n.level != level {
+		return nil, fmt.Errorf("%w: page %d is not on the level it is linked from", ErrCorruptPage, pageID)
+	}
+	return n, nil
+}
+
+// pin the node until the operation in progress is done, which does nothing on trees that only live in memory
+// nodes that are reached by following a link are fetched already, so this is for the root, and for nodes held on to from earlier in the operation
+func (t *Tree[T]) fetch(n *node[T]) *node[T] {
+	s := t.store
+	if s == nil {
+		return n
+	}
+
+	if s.file == nil {
+		panic(ErrClosed)
+	}
+
+	t.pin(n)
+	return n
+}
+
+// make the node resident if it is not already, and pin it until the operation in progress is done
+func (t *Tree[T]) pin(n *node[T]) {
+	p := &t.store.pool
+	if n.frame == nil {
+		n.frame = p.lru.PushFront(n)
+	} else {
+		p.lru.MoveToFront(n.frame)
+	}
+
+	n.pins++
+	p.pinned = append(p.pinned, n)
+	t.evict()
+}
+
+// unpin every node that the operation that just finished fetched, so that they can be evicted again
+func (t *Tree[T]) release() {
+	s := t.store
+	if s == nil {
+		return
+	}
+
+	for _, n := range s.pool.pinned {
+		n.pins--
+	}
+	clear(s.pool.pinned)
+	s.pool.pinned = s.pool.pinned[:0]
+	t.evict()
+}
+
+// drop the least recently used nodes until the pool is back within its budget
+// pinned nodes are skipped, and so are changed nodes that cannot be written back yet
+func (t *Tree[T]) evict() {
+	s := t.store
+	p := &s.pool
+
+	for e := p.lru.Back(); e != nil && p.overBudget(); {
+		n := e.Value.(*node[T])
+		e = e.Prev()
+
+		if n.pins > 0 || n == t.root {
+			continue
+		}
+		if _, dirty := s.dirty[n]; dirty {
+			// with a log, changes have to go through it before they reach the file
+			if s.wal != nil || s.writeBack(t, n) != nil {
+				continue
+			}
+		}
+
+		s.forget(n)
+		// children that are still resident get their parent back once an operation reaches them from it again
+		if !n.isLeaf {
+			for _, ptr := range n.pointers[:n.numKeys+1] {
+				if child, ok := s.nodes[uint64(ptr.(pageLink))]; ok && child.parent == n {
+					child.parent = nil
+				}
+			}
+		}
+		n.parent = nil
+		n.keys = nil
+		n.pointers = nil
+	}
+}
+
+// drop a node that is evicted or no longer part of the tree from the pool
+func (s *pageStore[T]) forget(n *node[T]) {
+	if n.frame != nil {
+		s.pool.lru.Remove(n.frame)
+		n.frame = nil
+	}
+	delete(s.nodes, n.pageID)
+}
+
+// write a changed node out to its page early, so that it can be evicted before the next sync
+func (s *pageStore[T]) writeBack(t *Tree[T], n *node[T]) error {
+	page, err := s.encodeNode(t, n)
+	if err != nil {
+		return err
+	}
+	images, err := s.appendImage(nil, n.pageID, page)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.file.WriteAt(images[0].data, int64(n.pageID)*int64(s.pageSize)); err != nil {
+		return err
+	}
+	delete(s.dirty, n)
+	return nil
+}
@@ -0,0 +1,156 @@
+package bptree
+
+import (
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBufferPoolStaysWithinBudget(t *testing.T) {
+	const pageSize = 128
+	const capacity = 6
+
+	for _, wal := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "tree.db")
+		opts := []TreeOption{WithOrder(4), WithPageSize(pageSize), WithMemoryBudget(capacity * pageSize)}
+		if wal {
+			opts = append(opts, WithWAL(), WithCheckpointSize(4096))
+		}
+
+		tree, err := Open[int](path, IntRecordCodec{}, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		r := rand.New(rand.NewSource(1))
+		expected := make(map[int]bool)
+		for i := range 3000 {
+			val := r.Intn(1000)
+			if r.Intn(3) == 0 && len(expected) > 0 {
+				if (tree.Delete(val) == nil) != expected[val] {
+					t.Fatalf("WAL %v, operation %d: delete of %d did not match the expected contents", wal, i, val)
+				}
+				delete(expected, val)
+			} else {
+				if (tree.Insert(NewIntRecord(val)) == nil) == expected[val] {
+					t.Fatalf("WAL %v, operation %d: insert of %d did not match the expected contents", wal, i, val)
+				}
+				expected[val] = true
+			}
+
+			if resident := tree.store.pool.lru.Len(); resident > capacity {
+				t.Fatalf("WAL %v, operation %d: expected at most %d resident nodes, got %d", wal, i, capacity, resident)
+			}
+		}
+
+		expectedArr := make([]int, 0, len(expected))
+		for val := range expected {
+			expectedArr = append(expectedArr, val)
+		}
+		slices.Sort(expectedArr)
+
+		if keys := treeKeys(tree); !slices.Equal(keys, expectedArr) {
+			t.Errorf("WAL %v: contents did not match:\nExpected: %v\nGot: %v", wal, expectedArr, keys)
+		}
+		if pages := tree.store.pageCount - 1 - uint64(len(tree.store.free)); pages <= capacity {
+			t.Fatalf("WAL %v: expected the tree to be larger than the pool, got %d nodes", wal, pages)
+		}
+		if err := tree.Close(); err != nil {
+			t.Fatalf("WAL %v: unexpected error on close: %v", wal, err)
+		}
+
+		// opening the tree only reads what fits in the pool
+		tree, err = Open[int](path, IntRecordCodec{}, opts...)
+		if err != nil {
+			t.Fatalf("WAL %v: unexpected error on reopen: %v", wal, err)
+		}
+		if resident := tree.store.pool.lru.Len(); resident > capacity {
+			t.Errorf("WAL %v: expected at most %d resident nodes after opening, got %d", wal, capacity, resident)
+		}
+		if keys := treeKeys(tree); !slices.Equal(keys, expectedArr) {
+			t.Errorf("WAL %v: contents did not match after reopening:\nExpected: %v\nGot: %v", wal, expectedArr, keys)
+		}
+		tree.Close()
+	}
+}
+
+func TestBufferPoolReleasesPinsAfterEveryOperation(t *testing.T) {
+	tree, err := Open[int](filepath.Join(t.TempDir(), "tree.db"), IntRecordCodec{}, WithPageSize(128), WithMemoryBudget(128))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+
+	for i := range 100 {
+		tree.Insert(NewIntRecord(i))
+	}
+	tree.FindPoint(50)
+	collectKeys(tree.FindRange(10, 60))
+	tree.Delete(20)
+
+	if pinned := len(tree.store.pool.pinned); pinned != 0 {
+		t.Errorf("Expected nothing to stay pinned, got %d nodes", pinned)
+	}
+	for e := tree.store.pool.lru.Front(); e != nil; e = e.Next() {
+		if n := e.Value.(*node[int]); n.pins != 0 {
+			t.Errorf("Expected page %d to be unpinned, got %d pins", n.pageID, n.pins)
+		}
+	}
+	if resident := tree.store.pool.lru.Len(); resident != 1 {
+		t.Errorf("Expected a single resident node, got %d", resident)
+	}
+}
+
+func TestBufferPoolOnlyKeepsResidentNodes(t *testing.T) {
+	const pageSize = 128
+	const capacity = 8
+
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := Open[int](path, IntRecordCodec{}, WithOrder(4), WithPageSize(pageSize))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for val := range 2000 {
+		tree.Insert(NewIntRecord(val))
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tree, err = Open[int](path, IntRecordCodec{}, WithMemoryBudget(capacity*pageSize))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+
+	// only the root is read when the tree is opened
+	if nodes := len(tree.store.nodes); nodes != 1 {
+		t.Errorf("Expected only the root in memory after opening, got %d nodes", nodes)
+	}
+
+	// however much of the tree is read, only the nodes in the pool stay in memory
+	checkNodes := func(operation string) {
+		t.Helper()
+		if nodes, resident := len(tree.store.nodes), tree.store.pool.lru.Len(); nodes != resident || nodes > capacity {
+			t.Errorf("%s: expected at most %d nodes in memory, all of them resident, got %d with %d resident", operation, capacity, nodes, resident)
+		}
+	}
+	if keys := collectKeys(tree.FindRange(0, 2000)); len(keys) != 2000 {
+		t.Errorf("Expected every key, got %d", len(keys))
+	}
+	checkNodes("FindRange")
+	if keys := collectKeys(tree.FindRangeReverse(1500, 500)); len(keys) != 1000 {
+		t.Errorf("Expected 1000 keys, got %d", len(keys))
+	}
+	checkNodes("FindRangeReverse")
+	for val := 0; val < 2000; val += 7 {
+		if err := tree.Delete(val); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	checkNodes("Delete")
+	if err := tree.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package bptree
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrUnsorted = errors.New("bptree: records are not sorted by key")
+
+// BulkLoad builds a tree from records that are already sorted by key
+//
+// Rather than inserting the records one at a time, the leaves are packed from left to right
+// and the nonleaf levels are built on top of them, from the bottom up
+// fillFactor is the fraction of each node that is filled, between 0 and 1
+// A lower fill factor leaves room for later inserts before nodes have to split
+//
+// Records that are out of order, or that share a key when the tree does not allow duplicates, are rejected with an error
+func BulkLoad[T cmp.Ordered](records Iterator[T], fillFactor float64, opts ...TreeOption) (*Tree[T], error) {
+	if fillFactor <= 0 || fillFactor > 1 {
+		return nil, fmt.Errorf("bptree: fill factor must be in (0, 1], got %v", fillFactor)
+	}
+
+	t := NewTree[T](opts...)
+
+	sorted := make([]Record[T], 0)
+	for record := records.Next(); record != nil; record = records.Next() {
+		if len(sorted) > 0 {
+			previous := sorted[len(sorted)-1].GetHashableVal()
+			if record.GetHashableVal() < previous {
+				return nil, fmt.Errorf("%w: %v comes after %v", ErrUnsorted, record.GetHashableVal(), previous)
+			}
+			if record.GetHashableVal() == previous && !t.allowDuplicates {
+				return nil, fmt.Errorf("%w: %v", ErrDuplicate, previous)
+			}
+		}
+
+		sorted = append(sorted, record)
+	}
+
+	if len(sorted) == 0 {
+		return t, nil
+	}
+
+	// pack the leaves from left to right, linking each one to the next
+	leafSizes := packedSizes(len(sorted), fillTarget(fillFactor, t.maxKeysPerNode), t.minLeafKeys, t.maxKeysPerNode)
+	level := make([]*node[T], 0, len(leafSizes))
+	for _, size := range leafSizes {
+		leaf := t.newNode()
+		leaf.isLeaf = true
+
+		for _, record := range sorted[:size] {
+			leaf.keys[leaf.numKeys] = record.GetHashableVal()
+			leaf.pointers[leaf.numKeys] = record
+			leaf.numKeys++
+		}
+		sorted = sorted[size:]
+		t.summarize(leaf)
+
+		if len(level) > 0 {
+			level[len(level)-1].pointers[t.maxLeafPointers] = leaf
+			leaf.prev = level[len(level)-1]
+		}
+		level = append(level, leaf)
+	}
+
+	// the smallest key under each node of the current level, used as the separators in the level above
+	lowestKeys := make([]T, len(level))
+	for i, leaf := range level {
+		lowestKeys[i] = leaf.keys[0]
+	}
+
+	// keep building levels on top until there is only the root left
+	minChildren := t.minNonLeafKeys + 1
+	for len(level) > 1 {
+		sizes := []int{len(level)}
+		if len(level) > t.maxNonLeafPointers {
+			sizes = packedSizes(len(level), fillTarget(fillFactor, t.maxNonLeafPointers), minChildren, t.maxNonLeafPointers)
+		}
+
+		parents := make([]*node[T], 0, len(sizes))
+		parentLowestKeys := make([]T, 0, len(sizes))
+		for _, size := range sizes {
+			parent := t.newNode()
+
+			for i, child := range level[:size] {
+				if i > 0 {
+					parent.keys[parent.numKeys] = lowestKeys[i]
+					parent.numKeys++
+				}
+				parent.pointers[i] = child
+				child.parent = parent
+			}
+			t.summarize(parent)
+
+			parents = append(parents, parent)
+			parentLowestKeys = append(parentLowestKeys, lowestKeys[0])
+			level = level[size:]
+			lowestKeys = lowestKeys[size:]
+		}
+
+		level = parents
+		lowestKeys = parentLowestKeys
+	}
+
+	t.root = level[0]
+	return t, nil
+}
+
+// the number of entries each node is filled to, which has to be at least one
+func fillTarget(fillFactor float64, capacity int) int {
+	return max(1, int(math.Ceil(fillFactor*float64(capacity))))
+}
+
+// split total entries into nodes of the target size, making sure that no node goes under the minimum
+// the target is clamped between the minimum and maximum, so only the last node can come up short
+func packedSizes(total int, target int, minSize int, maxSize int) []int {
+	target = min(max(target, minSize), maxSize)
+
+	sizes := make([]int, 0, total/target+1)
+	for remaining := total; remaining > 0; remaining -= target {
+		sizes = append(sizes, min(target, remaining))
+	}
+
+	last := len(sizes) - 1
+	if last > 0 && sizes[last] < minSize {
+		// either fold the last node into the one before it, or even the two out
+		combined := sizes[last-1] + sizes[last]
+		if combined <= maxSize {
+			sizes = sizes[:last]
+			sizes[last-1] = combined
+		} else {
+			sizes[last-1] = combined - minSize
+			sizes[last] = minSize
+		}
+	}
+
+	return sizes
+}
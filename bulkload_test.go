@@ -0,0 +1,112 @@
+package bptree
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func intRecords(vals ...int) Iterator[int] {
+	records := make([]Record[int], len(vals))
+	for i, val := range vals {
+		records[i] = NewIntRecord(val)
+	}
+	return NewSliceIterator(records)
+}
+
+func collectKeys(records Iterator[int]) []int {
+	keys := make([]int, 0)
+	for rec := records.Next(); rec != nil; rec = records.Next() {
+		keys = append(keys, rec.GetHashableVal())
+	}
+	return keys
+}
+
+func TestBulkLoadStructure(t *testing.T) {
+	var tests = []struct {
+		input      []int
+		fillFactor float64
+		output     string
+	}{
+		{[]int{1, 2, 3}, 1, "1 2 3 |"},
+		{[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 1, "4 7 9 |\n1 2 3 |4 5 6 |7 8 |9 10 |"},
+		{[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 0.5, "5 |\n3 |7 9 |\n1 2 |3 4 |5 6 |7 8 |9 10 |"},
+		{[]int{1, 2, 3, 4}, 1, "3 |\n1 2 |3 4 |"},
+	}
+
+	for _, test := range tests {
+		tree, err := BulkLoad(intRecords(test.input...), test.fillFactor)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if tree.String() != test.output {
+			t.Errorf("Format incorrect for %v at %v:\ngot:\n%s\nexpected:\n%s\n", test.input, test.fillFactor, tree.String(), test.output)
+		}
+	}
+}
+
+func TestBulkLoadThenModify(t *testing.T) {
+	for _, order := range []int{3, 4, 5, 16} {
+		for _, fillFactor := range []float64{0.1, 0.5, 0.7, 1} {
+			vals := make([]int, 0)
+			for i := range 500 {
+				vals = append(vals, i*2)
+			}
+
+			tree, err := BulkLoad(intRecords(vals...), fillFactor, WithOrder(order))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if keys := collectKeys(tree.FindRange(-1, 1000)); !slices.Equal(keys, vals) {
+				t.Fatalf("Order %d, fill factor %v: bulk loaded tree has the wrong contents: %v", order, fillFactor, keys)
+			}
+			checkLeafLinks(t, tree)
+
+			// the loaded tree should behave like any other tree
+			expected := make([]int, 0)
+			for i := range 1000 {
+				if i%2 == 1 {
+					tree.Insert(NewIntRecord(i))
+				} else if i%4 == 0 {
+					tree.Delete(i)
+					continue
+				}
+				expected = append(expected, i)
+			}
+
+			if keys := collectKeys(tree.FindRange(-1, 1000)); !slices.Equal(keys, expected) {
+				t.Errorf("Order %d, fill factor %v: modified tree has the wrong contents:\nExpected: %v\nGot: %v", order, fillFactor, expected, keys)
+			}
+			checkLeafLinks(t, tree)
+		}
+	}
+}
+
+func TestBulkLoadRejectsBadInput(t *testing.T) {
+	if _, err := BulkLoad(intRecords(1, 3, 2), 1); !errors.Is(err, ErrUnsorted) {
+		t.Errorf("Expected ErrUnsorted, got %v", err)
+	}
+	if _, err := BulkLoad(intRecords(1, 2, 2, 3), 1); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate, got %v", err)
+	}
+	if _, err := BulkLoad(intRecords(1, 2), 0); err == nil {
+		t.Errorf("Expected an error for a fill factor of 0")
+	}
+
+	tree, err := BulkLoad(intRecords(1, 2, 2, 2, 2, 2, 3), 1, WithDuplicates())
+	if err != nil {
+		t.Fatalf("Expected duplicates to be accepted, got %v", err)
+	}
+	if keys := collectKeys(tree.FindAll(2)); len(keys) != 5 {
+		t.Errorf("Expected 5 duplicates, got %v", keys)
+	}
+
+	tree, err = BulkLoad(intRecords(), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tree.String() != "" {
+		t.Errorf("Expected an empty tree, got %s", tree.String())
+	}
+}
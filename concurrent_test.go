@@ -0,0 +1,262 @@
+package bptree
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// keys that are a multiple of this are inserted up front and never touched again, so every scan has to see all of them
+const stableKeyStride = 10
+
+// the operations that the concurrent tests run against a tree
+type concurrentTree interface {
+	Insert(record Record[int]) error
+	Delete(val int) error
+	FindPoint(val int) (Record[int], error)
+	FindRange(low int, high int) Iterator[int]
+}
+
+// trees that can scan backwards as well, which readers then do every other scan
+type reverseScanner interface {
+	FindRangeReverse(high int, low int) Iterator[int]
+}
+
+// a Tree, with its reads narrowed down to the latest version
+type latestTree struct {
+	*Tree[int]
+}
+
+func (t latestTree) FindPoint(val int) (Record[int], error) {
+	return t.Tree.FindPoint(val)
+}
+
+func (t latestTree) FindRange(low int, high int) Iterator[int] {
+	return t.Tree.FindRange(low, high)
+}
+
+func (t latestTree) FindRangeReverse(high int, low int) Iterator[int] {
+	return t.Tree.FindRangeReverse(high, low)
+}
+
+func TestConcurrentOperations(t *testing.T) {
+	for _, order := range []int{3, 4, 8} {
+		t.Run(fmt.Sprintf("order %d", order), func(t *testing.T) {
+			tree := NewTree[int](WithOrder(order))
+			runConcurrentOperations(t, latestTree{tree})
+			checkParents(t, tree.root)
+			checkLeafLinks(t, tree)
+		})
+	}
+}
+
+// run writers that insert and delete alongside readers that look up and scan, and check the contents once the writers are done
+func runConcurrentOperations(t *testing.T, tree concurrentTree) {
+	const writers = 4
+	const readers = 4
+	const maxKey = 2000
+
+	stable := make([]int, 0)
+	for val := 0; val < maxKey; val += stableKeyStride {
+		tree.Insert(NewIntRecord(val))
+		stable = append(stable, val)
+	}
+
+	// each writer owns the keys that are not stable and that land on it
+	expected := make([]map[int]bool, writers)
+	done := make(chan struct{})
+	var writersDone sync.WaitGroup
+	var readersDone sync.WaitGroup
+
+	for w := range writers {
+		expected[w] = make(map[int]bool)
+		writersDone.Add(1)
+		go func() {
+			defer writersDone.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+
+			for range 3000 {
+				val := r.Intn(maxKey/writers)*writers + w
+				if val%stableKeyStride == 0 {
+					continue
+				}
+
+				if r.Intn(2) == 0 {
+					if (tree.Insert(NewIntRecord(val)) == nil) == expected[w][val] {
+						t.Errorf("Insert of %d did not match the expected contents", val)
+						return
+					}
+					expected[w][val] = true
+				} else {
+					if (tree.Delete(val) == nil) != expected[w][val] {
+						t.Errorf("Delete of %d did not match the expected contents", val)
+						return
+					}
+					delete(expected[w], val)
+				}
+			}
+		}()
+	}
+
+	for r := range readers {
+		readersDone.Add(1)
+		go func() {
+			defer readersDone.Done()
+			rng := rand.New(rand.NewSource(int64(writers + r)))
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				val := rng.Intn(maxKey/stableKeyStride) * stableKeyStride
+				if _, err := tree.FindPoint(val); err != nil {
+					t.Errorf("Stable key %d was not found: %v", val, err)
+					return
+				}
+
+				// a scan can miss or see keys that change under it, but has to stay in order and see every stable key once
+				var keys []int
+				if reverse, ok := tree.(reverseScanner); ok && rng.Intn(2) == 0 {
+					keys = collectKeys(reverse.FindRangeReverse(maxKey, 0))
+					slices.Reverse(keys)
+				} else {
+					keys = collectKeys(tree.FindRange(0, maxKey))
+				}
+				for i := 1; i < len(keys); i++ {
+					if keys[i] <= keys[i-1] {
+						t.Errorf("Scan was not in order, %d came after %d", keys[i], keys[i-1])
+						return
+					}
+				}
+
+				seenStable := make([]int, 0, len(stable))
+				for _, val := range keys {
+					if val%stableKeyStride == 0 {
+						seenStable = append(seenStable, val)
+					}
+				}
+				if !slices.Equal(seenStable, stable) {
+					t.Errorf("Scan did not see every stable key:\nExpected: %v\nGot: %v", stable, seenStable)
+					return
+				}
+			}
+		}()
+	}
+
+	writersDone.Wait()
+	close(done)
+	readersDone.Wait()
+
+	expectedArr := slices.Clone(stable)
+	for _, keys := range expected {
+		for val := range keys {
+			expectedArr = append(expectedArr, val)
+		}
+	}
+	slices.Sort(expectedArr)
+
+	if keys := collectKeys(tree.FindRange(0, maxKey)); !slices.Equal(keys, expectedArr) {
+		t.Errorf("Contents did not match after the writers finished:\nExpected: %v\nGot: %v", expectedArr, keys)
+	}
+}
+
+func TestConcurrentOperationsWithDuplicates(t *testing.T) {
+	const writers = 4
+
+	tree := NewTree[int](WithOrder(4), WithDuplicates())
+	// lookups panic on a tree that was never inserted into, so start off with a record outside of the keys that are used
+	tree.Insert(NewIntRecord(100))
+
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+
+			// each writer only deletes the records it inserted itself
+			inserted := make([]Record[int], 0)
+			for range 2000 {
+				switch {
+				case r.Intn(3) == 0 && len(inserted) > 0:
+					i := r.Intn(len(inserted))
+					if err := tree.DeleteRecord(inserted[i]); err != nil {
+						t.Errorf("Could not delete record %v: %v", inserted[i], err)
+						return
+					}
+					inserted = slices.Delete(inserted, i, i+1)
+				case r.Intn(2) == 0:
+					record := &labelledRecord{r.Intn(50), fmt.Sprint(w)}
+					tree.Insert(record)
+					inserted = append(inserted, record)
+				default:
+					val := r.Intn(50)
+					for _, key := range collectKeys(tree.FindAll(val)) {
+						if key != val {
+							t.Errorf("FindAll for %d returned %d", val, key)
+							return
+						}
+					}
+				}
+			}
+
+			for _, record := range inserted {
+				if err := tree.DeleteRecord(record); err != nil {
+					t.Errorf("Could not delete record %v: %v", record, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if keys := collectKeys(tree.FindRange(0, 200)); !slices.Equal(keys, []int{100}) {
+		t.Errorf("Expected only the first record to be left, got %v", keys)
+	}
+}
+
+// make sure that every leaf links back to the leaf that links to it
+func checkLeafLinks(t *testing.T, tree *Tree[int]) {
+	if tree.root == nil {
+		return
+	}
+
+	leaf := tree.root
+	for !leaf.isLeaf {
+		leaf = leaf.pointers[0].(*node[int])
+	}
+	if leaf.prev != nil {
+		t.Errorf("First leaf %v links back to %v", leaf.keys[:leaf.numKeys], leaf.prev.keys[:leaf.prev.numKeys])
+	}
+
+	for {
+		next, ok := leaf.pointers[tree.maxLeafPointers].(*node[int])
+		if !ok {
+			return
+		}
+		if next.prev != leaf {
+			t.Errorf("Leaf %v does not link back to %v", next.keys[:next.numKeys], leaf.keys[:leaf.numKeys])
+		}
+		leaf = next
+	}
+}
+
+// make sure that every child's parent pointer points back at the node it is in
+func checkParents(t *testing.T, n *node[int]) {
+	if n.isLeaf {
+		return
+	}
+
+	for _, ptr := range n.pointers[:n.numKeys+1] {
+		child := ptr.(*node[int])
+		if child.parent != n {
+			t.Errorf("Child %v of %v has the wrong parent", child.keys[:child.numKeys], n.keys[:n.numKeys])
+		}
+		checkParents(t, child)
+	}
+}
@@ -0,0 +1,160 @@
+package bptree
+
+import "fmt"
+
+// WithCounts has every node keep a count of the records under it, so that records can be ranked and found by their position
+func WithCounts() TreeOption {
+	return func(o *treeOptions) {
+		o.counted = true
+	}
+}
+
+// Rank returns the number of records with a key less than the key, which is the position the key has or would have in the tree
+func (t *Tree[T]) Rank(key T) (rank int, err error) {
+	defer t.catchCorrupt(&err)
+
+	unlock, err := t.lockCounts()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return t.countBelow(key, false), nil
+}
+
+// Select returns the record at the position in key order, starting from 0, or ErrNotFound if there are not that many records
+// If duplicates are allowed, records with equal keys are in the order they were inserted in
+func (t *Tree[T]) Select(i int) (record Record[T], err error) {
+	defer t.catchCorrupt(&err)
+
+	unlock, err := t.lockCounts()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if t.root == nil {
+		return nil, ErrEmpty
+	}
+	if i < 0 || i >= t.root.count {
+		return nil, fmt.Errorf("%w: position %d of %d", ErrNotFound, i, t.root.count)
+	}
+
+	n := t.root
+	for !n.isLeaf {
+		for ptrIdx := range n.numKeys + 1 {
+			child := t.child(n, ptrIdx)
+			if i < child.count {
+				n = child
+				break
+			}
+			i -= child.count
+		}
+	}
+
+	for idx := range n.numKeys {
+		record := t.recordAt(n, idx, latestVersion)
+		if record == nil {
+			continue
+		}
+		if i == 0 {
+			return record, nil
+		}
+		i--
+	}
+
+	corrupt(n, "node count does not match its records")
+	return nil, nil
+}
+
+// CountRange returns the number of records that satisfy low <= x < high
+func (t *Tree[T]) CountRange(low T, high T) (int, error) {
+	return t.Count(halfOpen(low, high))
+}
+
+// Count returns the number of records with a key in the range
+func (t *Tree[T]) Count(keys KeyRange[T]) (count int, err error) {
+	defer t.catchCorrupt(&err)
+
+	unlock, err := t.lockCounts()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if t.root == nil {
+		return 0, nil
+	}
+
+	upTo := t.root.count
+	switch keys.High.kind {
+	case inclusive:
+		upTo = t.countBelow(keys.High.key, true)
+	case exclusive:
+		upTo = t.countBelow(keys.High.key, false)
+	}
+
+	before := 0
+	switch keys.Low.kind {
+	case inclusive:
+		before = t.countBelow(keys.Low.key, false)
+	case exclusive:
+		before = t.countBelow(keys.Low.key, true)
+	}
+
+	// a range with its bounds the wrong way around is empty
+	return max(upTo-before, 0), nil
+}
+
+// lock the tree for reading its counts, or return ErrUnsupported on a tree without them
+// writers to a counted tree hold the whole tree, so the counts can be read without latching the nodes
+func (t *Tree[T]) lockCounts() (func(), error) {
+	if !t.counted {
+		return nil, fmt.Errorf("%w: only trees created with WithCounts can find records by their position", ErrUnsupported)
+	}
+	_, unlock := t.lockTree(latchRead)
+	return unlock, nil
+}
+
+// the number of records with a key less than the key, or not greater than it if inclusive is set
+// the tree has to be locked already
+func (t *Tree[T]) countBelow(key T, inclusive bool) int {
+	if t.root == nil {
+		return 0
+	}
+
+	// every child to the left of the one the key leads to only has keys below it
+	below := func(k T) bool {
+		if inclusive {
+			return k <= key
+		}
+		return k < key
+	}
+
+	count := 0
+	n := t.root
+	for !n.isLeaf {
+		ptrIdx := n.numKeys
+		for i, separator := range n.keys[:n.numKeys] {
+			if !below(separator) {
+				ptrIdx = i
+				break
+			}
+		}
+
+		for i := range ptrIdx {
+			count += t.child(n, i).count
+		}
+		n = t.child(n, ptrIdx)
+	}
+
+	for idx, k := range n.keys[:n.numKeys] {
+		if !below(k) {
+			break
+		}
+		if t.recordAt(n, idx, latestVersion) != nil {
+			count++
+		}
+	}
+	return count
+}
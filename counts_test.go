@@ -0,0 +1,218 @@
+package bptree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// check that the count of every node matches the records under it
+func checkCounts(t *testing.T, tree *Tree[int]) {
+	t.Helper()
+	if tree.root == nil {
+		return
+	}
+
+	var walk func(n *node[int]) int
+	walk = func(n *node[int]) int {
+		count := 0
+		if n.isLeaf {
+			for i := range n.numKeys {
+				if tree.recordAt(n, i, latestVersion) != nil {
+					count++
+				}
+			}
+		} else {
+			for _, ptr := range n.pointers[:n.numKeys+1] {
+				count += walk(ptr.(*node[int]))
+			}
+		}
+
+		if n.count != count {
+			t.Fatalf("Expected a count of %d for the node with keys %v, got %d", count, n.keys[:n.numKeys], n.count)
+		}
+		return count
+	}
+	walk(tree.root)
+}
+
+// check every position and a spread of ranks and ranges against the labels of the records in key order
+func checkPositions(t *testing.T, tree *Tree[int], records []*labelledRecord) {
+	t.Helper()
+	checkCounts(t, tree)
+
+	model := modelOrder(records)
+	for i, label := range model {
+		if found, err := tree.Select(i); err != nil || found.String() != label {
+			t.Fatalf("Expected Select(%d) to be %s, got %v", i, label, found)
+		}
+	}
+	if found, err := tree.Select(len(model)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected nothing past the last record, got %v", found)
+	}
+
+	below := func(key int) int {
+		count := 0
+		for _, record := range records {
+			if record.key < key {
+				count++
+			}
+		}
+		return count
+	}
+	for key := -2; key < 102; key += 3 {
+		if found, err := tree.Rank(key); err != nil || found != below(key) {
+			t.Fatalf("Expected Rank(%d) to be %d, got %d", key, below(key), found)
+		}
+		for _, high := range []int{key - 1, key, key + 1, key + 17} {
+			expected := max(below(high)-below(key), 0)
+			if found, err := tree.CountRange(key, high); err != nil || found != expected {
+				t.Fatalf("Expected CountRange(%d, %d) to be %d, got %d", key, high, expected, found)
+			}
+		}
+	}
+}
+
+func TestCountsMatchModel(t *testing.T) {
+	for _, order := range []int{3, 4, 8} {
+		for _, duplicates := range []bool{false, true} {
+			t.Run(fmt.Sprintf("order %d, duplicates %v", order, duplicates), func(t *testing.T) {
+				opts := []TreeOption{WithOrder(order), WithCounts()}
+				if duplicates {
+					opts = append(opts, WithDuplicates())
+				}
+				tree := NewTree[int](opts...)
+				records := make([]*labelledRecord, 0)
+				r := rand.New(rand.NewSource(int64(order)))
+
+				for i := range 1500 {
+					key := r.Intn(100)
+					if r.Intn(3) > 0 {
+						record := &labelledRecord{key, fmt.Sprint(i)}
+						if tree.Insert(record) == nil {
+							records = append(records, record)
+						}
+					} else if idx := slices.IndexFunc(records, func(record *labelledRecord) bool {
+						return record.key == key
+					}); idx != -1 {
+						// the first record with the key is the one that was inserted first
+						tree.Delete(key)
+						records = slices.Delete(records, idx, idx+1)
+					}
+
+					if i%100 == 0 {
+						checkPositions(t, tree, records)
+					}
+				}
+				checkPositions(t, tree, records)
+
+				for _, record := range slices.Clone(records) {
+					tree.Delete(record.key)
+				}
+				checkPositions(t, tree, nil)
+			})
+		}
+	}
+}
+
+func TestCountsSkipDeletedVersions(t *testing.T) {
+	tree := NewTree[int](WithOrder(3), WithCounts(), WithVersions())
+	records := make([]*labelledRecord, 0)
+	for key := range 40 {
+		record := &labelledRecord{key, fmt.Sprint(key)}
+		tree.Insert(record)
+		records = append(records, record)
+	}
+
+	reader, err := tree.OpenReader()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	kept := make([]*labelledRecord, 0)
+	for _, record := range records {
+		if record.key%4 == 0 {
+			tree.Delete(record.key)
+		} else {
+			kept = append(kept, record)
+		}
+	}
+	checkPositions(t, tree, kept)
+
+	// a key that is inserted again counts once more
+	revived := &labelledRecord{8, "revived"}
+	tree.Insert(revived)
+	kept = append(kept, revived)
+	checkPositions(t, tree, kept)
+
+	reader.Close()
+	tree.GC()
+	checkPositions(t, tree, kept)
+}
+
+func TestCountsOfOtherWrites(t *testing.T) {
+	records := make([]Record[int], 0)
+	labelled := make([]*labelledRecord, 0)
+	for key := range 60 {
+		record := &labelledRecord{key * 2, fmt.Sprint(key * 2)}
+		records = append(records, record)
+		labelled = append(labelled, record)
+	}
+
+	tree, err := BulkLoad(NewSliceIterator(records), 0.7, WithOrder(4), WithCounts())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkPositions(t, tree, labelled)
+
+	// writers copy the nodes they change while the snapshot is open, which have to keep their counts
+	snapshot := tree.Snapshot()
+	tx := tree.Begin()
+	for key := 1; key < 40; key += 2 {
+		record := &labelledRecord{key, fmt.Sprint(key)}
+		tx.Insert(record)
+		labelled = append(labelled, record)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkPositions(t, tree, labelled)
+	snapshot.Close()
+
+	if found, err := tree.Count(KeyRange[int]{}); err != nil || found != len(labelled) {
+		t.Errorf("Expected every record to be counted, got %d", found)
+	}
+	if found, err := tree.Count(KeyRange[int]{Low: Exclusive(10), High: Inclusive(20)}); err != nil || found != 10 {
+		t.Errorf("Expected 10 records in (10, 20], got %d", found)
+	}
+	if found, err := tree.Count(KeyRange[int]{Low: Inclusive(100)}); err != nil || found != 10 {
+		t.Errorf("Expected 10 records from 100 up, got %d", found)
+	}
+}
+
+func TestCountsNeedOption(t *testing.T) {
+	tree := NewTree[int]()
+	if _, err := tree.Rank(1); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported from Rank, got %v", err)
+	}
+	if _, err := tree.Count(KeyRange[int]{}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported from Count, got %v", err)
+	}
+	if _, err := tree.Select(0); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported from Select, got %v", err)
+	}
+}
+
+func TestCountsOfEmptyTree(t *testing.T) {
+	tree := NewTree[int](WithCounts())
+	if rank, err := tree.Rank(1); err != nil || rank != 0 {
+		t.Errorf("Expected a rank of 0 in an empty tree, got %d and %v", rank, err)
+	}
+	if count, err := tree.CountRange(0, 10); err != nil || count != 0 {
+		t.Errorf("Expected an empty tree to have no records, got %d and %v", count, err)
+	}
+	if _, err := tree.Select(0); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrEmpty from Select on an empty tree, got %v", err)
+	}
+}
@@ -0,0 +1,390 @@
+package bptree
+
+import "cmp"
+
+// Cursor moves over the records of a tree in either direction, and can be moved to any key without starting a new scan
+// Like the iterators from FindRange, it does not hold the tree in between calls,
+// and if the leaf it is in has changed since, or the tree is stored in a file, it finds its place again by key
+// Among records with equal keys, it counts its way to its place, so changes to that run of records can make it skip or repeat one of them
+// A cursor is not safe for concurrent use
+type Cursor[T cmp.Ordered] struct {
+	tree *Tree[T]
+	// the version the records are read as of
+	asOf uint64
+
+	valid  bool
+	record Record[T]
+
+	// where the record is, as of the version of the leaf when it was last seen
+	leaf    *node[T]
+	idx     int
+	version uint64
+
+	// the record's key, and how many entries with the key come before it, or after it if fromRight is set
+	// which one is known depends on the direction the cursor got to the record from
+	key       T
+	ordinal   int
+	fromRight bool
+
+	// the failure that stopped the last move
+	err error
+	// why the tree cannot be read as the options the cursor was opened with ask
+	optionErr error
+}
+
+// Cursor returns a cursor over the tree, which is not at any record until it is moved to one
+// If the tree cannot be read as the options ask, every move fails with the error
+func (t *Tree[T]) Cursor(opts ...ReadOption) *Cursor[T] {
+	asOf, err := t.readVersion(opts)
+	return &Cursor[T]{
+		tree:      t,
+		asOf:      asOf,
+		optionErr: err,
+	}
+}
+
+// First moves the cursor to the first record in the tree, and returns whether there is one
+func (c *Cursor[T]) First() bool {
+	return c.move((*leafWalk[T]).first)
+}
+
+// Last moves the cursor to the last record in the tree, and returns whether there is one
+func (c *Cursor[T]) Last() bool {
+	return c.move((*leafWalk[T]).last)
+}
+
+// Seek moves the cursor to the first record with a key that is not less than the key, and returns whether there is one
+func (c *Cursor[T]) Seek(key T) bool {
+	return c.move(func(w *leafWalk[T]) walkResult {
+		return w.ceiling(key)
+	})
+}
+
+// SeekForPrev moves the cursor to the last record with a key that is not greater than the key, and returns whether there is one
+func (c *Cursor[T]) SeekForPrev(key T) bool {
+	return c.move(func(w *leafWalk[T]) walkResult {
+		return w.floor(key)
+	})
+}
+
+// Next moves the cursor to the record after the one it is at, and returns whether there is one
+// A cursor that is not at a record stays that way until it is moved with First, Last, Seek or SeekForPrev
+func (c *Cursor[T]) Next() bool {
+	if !c.valid {
+		return false
+	}
+
+	return c.move(c.after)
+}
+
+// Prev moves the cursor to the record before the one it is at, and returns whether there is one
+// A cursor that is not at a record stays that way until it is moved with First, Last, Seek or SeekForPrev
+func (c *Cursor[T]) Prev() bool {
+	if !c.valid {
+		return false
+	}
+
+	return c.move(c.before)
+}
+
+// Valid returns whether the cursor is at a record
+func (c *Cursor[T]) Valid() bool {
+	return c.valid
+}
+
+// Key returns the key of the record the cursor is at, or the zero value if it is not at one
+func (c *Cursor[T]) Key() T {
+	if !c.valid {
+		var zero T
+		return zero
+	}
+	return c.key
+}
+
+// Record returns the record the cursor is at, or nil if it is not at one
+func (c *Cursor[T]) Record() Record[T] {
+	return c.record
+}
+
+// Err returns the error that kept the last move from finding its record, such as a failure to read a node of a tree stored in a file,
+// or nil if the move went through, even if there was no record to move to
+// The cursor is not at any record after a move that failed
+func (c *Cursor[T]) Err() error {
+	return c.err
+}
+
+// lock the tree and walk to the record the cursor moves to
+func (c *Cursor[T]) move(walk func(w *leafWalk[T]) walkResult) bool {
+	t := c.tree
+	c.valid, c.record, c.err = false, nil, c.optionErr
+	if c.err != nil {
+		return false
+	}
+	defer t.catchCorrupt(&c.err)
+	mode, unlock := t.lockTree(latchRead)
+	defer unlock()
+	defer t.release()
+	t.checkVersion(c.asOf)
+
+	if t.isEmpty() {
+		return false
+	}
+	return c.walk(mode, walk)
+}
+
+// walk to the record the cursor moves to in a tree that is already locked, with the mode it was locked in
+func (c *Cursor[T]) walk(mode latchMode, walk func(w *leafWalk[T]) walkResult) bool {
+	t := c.tree
+	w, result := t.walkTo(c.asOf, mode, walk)
+	defer w.latches.release()
+
+	c.valid, c.record = result == walked, nil
+	if c.valid {
+		c.record = t.recordAt(w.leaf, w.idx, c.asOf)
+		c.leaf, c.idx, c.version = w.leaf, w.idx, w.leaf.version
+		c.key, c.ordinal, c.fromRight = w.key, w.ordinal, w.fromRight
+	}
+	return c.valid
+}
+
+// walk to the record after the one the cursor is at
+func (c *Cursor[T]) after(w *leafWalk[T]) walkResult {
+	exact, result := w.find(c)
+	if result == walkBlocked {
+		return result
+	}
+
+	// if the record is gone, the walk is already at the record after it when it came from the left
+	if !exact && !c.fromRight {
+		return w.skipRight(result)
+	}
+	return w.nextRecord()
+}
+
+// walk to the record before the one the cursor is at
+func (c *Cursor[T]) before(w *leafWalk[T]) walkResult {
+	exact, result := w.find(c)
+	if result == walkBlocked {
+		return result
+	}
+
+	// if the record is gone, the walk is already at the record before it when it came from the right
+	if !exact && c.fromRight {
+		return w.skipLeft(result)
+	}
+	return w.prevRecord()
+}
+
+// walk to a record in a tree that is already locked, with the mode it was locked in, starting over whenever the walk has to back off
+// the walk still holds the latch on the leaf it ended in, which the caller releases
+func (t *Tree[T]) walkTo(asOf uint64, mode latchMode, walk func(w *leafWalk[T]) walkResult) (*leafWalk[T], walkResult) {
+	for {
+		w := &leafWalk[T]{
+			tree: t,
+			mode: mode,
+			asOf: asOf,
+		}
+		if result := walk(w); result != walkBlocked {
+			return w, result
+		}
+	}
+}
+
+// how a step of a walk over the leaves went
+type walkResult int
+
+const (
+	walked walkResult = iota
+	// there are no more entries in the direction of the walk
+	walkedOff
+	// the next leaf was latched, so every latch has been let go of and the walk has to start over
+	walkBlocked
+)
+
+// walks over the entries in the leaves one at a time, holding the latch on the leaf it is in
+// it counts the entries with the same key as it goes, so that the cursor can find its place again among equal keys
+type leafWalk[T cmp.Ordered] struct {
+	tree *Tree[T]
+	mode latchMode
+	asOf uint64
+
+	// idx is -1 or the number of keys once the walk is off the start or the end of the leaves
+	leaf    *node[T]
+	idx     int
+	latches *latchPath[T]
+
+	// the key of the entry the walk is at, and how many entries with the key come before it, or after it if fromRight is set
+	// until the walk is at an entry, or once it is off either end, known is false
+	key       T
+	ordinal   int
+	fromRight bool
+	known     bool
+}
+
+// walk to the first record in the tree
+func (w *leafWalk[T]) first() walkResult {
+	leaf, latches := w.tree.findFirstLeaf(w.mode)
+	w.leaf, w.idx, w.latches = leaf, -1, latches
+	return w.nextRecord()
+}
+
+// walk to the last record in the tree
+func (w *leafWalk[T]) last() walkResult {
+	leaf, latches := w.tree.findLastLeaf(w.mode)
+	w.leaf, w.idx, w.latches = leaf, leaf.numKeys, latches
+	return w.prevRecord()
+}
+
+// walk to the first record with a key that is not less than the key
+func (w *leafWalk[T]) ceiling(key T) walkResult {
+	leaf, idx, latches := w.tree.findNodeAndIdx(key, w.mode)
+	w.leaf, w.idx, w.latches = leaf, idx-1, latches
+	return w.nextRecord()
+}
+
+// walk to the first record with a key that is greater than the key
+func (w *leafWalk[T]) higher(key T) walkResult {
+	leaf, idx, latches := w.tree.findLastAtMost(key, w.mode)
+	w.leaf, w.idx, w.latches = leaf, idx, latches
+	return w.nextRecord()
+}
+
+// walk to the last record with a key that is not greater than the key
+func (w *leafWalk[T]) floor(key T) walkResult {
+	leaf, idx, latches := w.tree.findLastAtMost(key, w.mode)
+	w.leaf, w.idx, w.latches = leaf, idx+1, latches
+	return w.prevRecord()
+}
+
+// walk to the last record with a key that is less than the key
+func (w *leafWalk[T]) lower(key T) walkResult {
+	leaf, idx, latches := w.tree.findNodeAndIdx(key, w.mode)
+	w.leaf, w.idx, w.latches = leaf, idx, latches
+	return w.prevRecord()
+}
+
+// walk to the entry of the cursor's record, and return whether it is still there
+// if it is not, the walk is at the entry that would come after it, or before it if the cursor got there from the right
+func (w *leafWalk[T]) find(c *Cursor[T]) (bool, walkResult) {
+	t := w.tree
+	// on a tree stored in a file, the leaf may have been evicted or freed since, and the leaves around it are only found through the parents
+	// that the walk passes on its way down, so the walk always finds its place by key
+	if t.store == nil {
+		leaf := c.leaf
+		latchNode(leaf, w.mode)
+		if leaf.version == c.version {
+			w.leaf, w.idx = leaf, c.idx
+			w.latches = &latchPath[T]{tree: t, mode: w.mode, nodes: []*node[T]{leaf}}
+			w.key, w.ordinal, w.fromRight, w.known = c.key, c.ordinal, c.fromRight, true
+			return true, walked
+		}
+		unlatchNode(leaf, w.mode)
+	}
+
+	var result walkResult
+	if !c.fromRight {
+		leaf, idx, latches := t.findNodeAndIdx(c.key, w.mode)
+		w.leaf, w.idx, w.latches = leaf, idx-1, latches
+		result = w.right()
+		for result == walked && w.key == c.key && w.ordinal < c.ordinal {
+			result = w.right()
+		}
+	} else {
+		leaf, idx, latches := t.findLastAtMost(c.key, w.mode)
+		w.leaf, w.idx, w.latches = leaf, idx+1, latches
+		result = w.left()
+		for result == walked && w.key == c.key && w.ordinal < c.ordinal {
+			result = w.left()
+		}
+	}
+
+	exact := result == walked && w.key == c.key && w.ordinal == c.ordinal
+	return exact, result
+}
+
+// step to the next entry
+func (w *leafWalk[T]) right() walkResult {
+	w.idx++
+	for w.idx >= w.leaf.numKeys {
+		next, ok := w.tree.nextLeaf(w.leaf)
+		if !ok {
+			w.idx, w.known = w.leaf.numKeys, false
+			return walkedOff
+		}
+
+		// leaves are latched left to right, against the order of merges, so back off rather than wait
+		if !tryLatchNode(next, w.mode) {
+			w.latches.release()
+			return walkBlocked
+		}
+		w.latches.moveTo(next)
+		w.leaf, w.idx = next, 0
+	}
+
+	key := w.leaf.keys[w.idx]
+	switch {
+	case !w.known || key != w.key:
+		w.key, w.ordinal, w.fromRight, w.known = key, 0, false, true
+	case w.fromRight:
+		w.ordinal = max(w.ordinal-1, 0)
+	default:
+		w.ordinal++
+	}
+	return walked
+}
+
+// step to the previous entry
+func (w *leafWalk[T]) left() walkResult {
+	w.idx--
+	for w.idx < 0 {
+		prev, ok := w.tree.prevLeaf(w.leaf)
+		if !ok {
+			w.idx, w.known = -1, false
+			return walkedOff
+		}
+
+		// this latches leaves right to left, against the order of splits and merges, so back off rather than wait
+		if !tryLatchNode(prev, w.mode) {
+			w.latches.release()
+			return walkBlocked
+		}
+		w.latches.moveTo(prev)
+		w.leaf, w.idx = prev, prev.numKeys-1
+	}
+
+	key := w.leaf.keys[w.idx]
+	switch {
+	case !w.known || key != w.key:
+		w.key, w.ordinal, w.fromRight, w.known = key, 0, true, true
+	case w.fromRight:
+		w.ordinal++
+	default:
+		w.ordinal = max(w.ordinal-1, 0)
+	}
+	return walked
+}
+
+// step to the next entry with a record as of the version the walk reads
+func (w *leafWalk[T]) nextRecord() walkResult {
+	return w.skipRight(w.right())
+}
+
+// step to the previous entry with a record as of the version the walk reads
+func (w *leafWalk[T]) prevRecord() walkResult {
+	return w.skipLeft(w.left())
+}
+
+// keys that were deleted as of the version are skipped over, from the entry the walk is at onwards
+func (w *leafWalk[T]) skipRight(result walkResult) walkResult {
+	for result == walked && w.tree.recordAt(w.leaf, w.idx, w.asOf) == nil {
+		result = w.right()
+	}
+	return result
+}
+
+func (w *leafWalk[T]) skipLeft(result walkResult) walkResult {
+	for result == walked && w.tree.recordAt(w.leaf, w.idx, w.asOf) == nil {
+		result = w.left()
+	}
+	return result
+}
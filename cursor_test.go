@@ -0,0 +1,356 @@
+package bptree
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// the labels of the records in the order the tree keeps them, which for duplicates is the order they were inserted in
+func modelOrder(records []*labelledRecord) []string {
+	sorted := slices.Clone(records)
+	slices.SortStableFunc(sorted, func(a, b *labelledRecord) int {
+		return a.key - b.key
+	})
+
+	labels := make([]string, 0, len(sorted))
+	for _, record := range sorted {
+		labels = append(labels, record.label)
+	}
+	return labels
+}
+
+func cursorLabel(c *Cursor[int]) string {
+	if !c.Valid() {
+		return "<none>"
+	}
+	return c.Record().String()
+}
+
+func TestCursorMatchesModel(t *testing.T) {
+	for _, order := range []int{3, 4, 8} {
+		tree := NewTree[int](WithOrder(order), WithDuplicates())
+		records := make([]*labelledRecord, 0)
+		r := rand.New(rand.NewSource(int64(order)))
+		for i := range 300 {
+			record := &labelledRecord{r.Intn(80), fmt.Sprint(i)}
+			tree.Insert(record)
+			records = append(records, record)
+		}
+
+		model := modelOrder(records)
+		keyAt := func(i int) int {
+			return records[slices.IndexFunc(records, func(record *labelledRecord) bool {
+				return record.label == model[i]
+			})].key
+		}
+
+		c := tree.Cursor()
+		pos := -1
+		for step := range 2000 {
+			var op string
+			switch r.Intn(7) {
+			case 0:
+				op = "First"
+				c.First()
+				pos = 0
+			case 1:
+				op = "Last"
+				c.Last()
+				pos = len(model) - 1
+			case 2:
+				key := r.Intn(90) - 5
+				op = fmt.Sprintf("Seek(%d)", key)
+				c.Seek(key)
+				pos = len(model)
+				for i := range model {
+					if keyAt(i) >= key {
+						pos = i
+						break
+					}
+				}
+			case 3:
+				key := r.Intn(90) - 5
+				op = fmt.Sprintf("SeekForPrev(%d)", key)
+				c.SeekForPrev(key)
+				pos = -1
+				for i := range model {
+					if keyAt(i) <= key {
+						pos = i
+					}
+				}
+			case 4:
+				op = "Next"
+				if pos < 0 || pos >= len(model) {
+					if c.Next() {
+						t.Fatalf("Order %d, step %d: expected Next to stay off the records", order, step)
+					}
+					continue
+				}
+				c.Next()
+				pos++
+			case 5:
+				op = "Prev"
+				if pos < 0 || pos >= len(model) {
+					if c.Prev() {
+						t.Fatalf("Order %d, step %d: expected Prev to stay off the records", order, step)
+					}
+					continue
+				}
+				c.Prev()
+				pos--
+			case 6:
+				// changes to the cursor's leaf make it find its place again, which holds up for equal keys unless their run changes
+				record := &labelledRecord{r.Intn(80), fmt.Sprint(len(records))}
+				if c.Valid() && record.key == c.Key() {
+					continue
+				}
+				op = fmt.Sprintf("Insert(%d)", record.key)
+				tree.Insert(record)
+				records = append(records, record)
+
+				current := cursorLabel(c)
+				model = modelOrder(records)
+				if c.Valid() {
+					pos = slices.Index(model, current)
+				} else if pos >= 0 {
+					pos = len(model)
+				}
+			}
+
+			expected := "<none>"
+			if pos >= 0 && pos < len(model) {
+				expected = model[pos]
+			}
+			if found := cursorLabel(c); found != expected {
+				t.Fatalf("Order %d, step %d: expected %s to be at %s, got %s", order, step, op, expected, found)
+			}
+			if c.Valid() && c.Key() != keyAt(pos) {
+				t.Fatalf("Order %d, step %d: expected key %d, got %d", order, step, keyAt(pos), c.Key())
+			}
+		}
+	}
+}
+
+func TestCursorFindsItsPlaceAfterChanges(t *testing.T) {
+	tree := NewTree[int](WithOrder(3))
+	for val := range 100 {
+		tree.Insert(NewIntRecord(val * 2))
+	}
+
+	c := tree.Cursor()
+	if !c.Seek(100) || c.Key() != 100 {
+		t.Fatalf("Expected the cursor at 100, got %v", c.Record())
+	}
+
+	// enough changes around the cursor to split and merge its leaf
+	for val := 60; val < 140; val++ {
+		if val%2 == 1 {
+			tree.Insert(NewIntRecord(val))
+		}
+	}
+	if !c.Next() || c.Key() != 101 {
+		t.Errorf("Expected the record inserted after the cursor, got %v", c.Record())
+	}
+	for val := 80; val < 120; val++ {
+		if val != 101 {
+			tree.Delete(val)
+		}
+	}
+	if !c.Prev() || c.Key() != 79 {
+		t.Errorf("Expected the record left before the cursor, got %v", c.Record())
+	}
+
+	// once the record the cursor is at is gone, it moves on to what was around it
+	tree.Delete(79)
+	if !c.Next() || c.Key() != 101 {
+		t.Errorf("Expected the record after the deleted one, got %v", c.Record())
+	}
+	tree.Delete(101)
+	if !c.Prev() || c.Key() != 78 {
+		t.Errorf("Expected the record before the deleted one, got %v", c.Record())
+	}
+}
+
+func TestCursorAfterItsLeafIsFreed(t *testing.T) {
+	tree, err := Open[int](filepath.Join(t.TempDir(), "tree.db"), IntRecordCodec{}, WithOrder(4), WithPageSize(128))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+	for val := range 40 {
+		tree.Insert(NewIntRecord(val))
+	}
+
+	c := tree.Cursor()
+	if !c.Seek(30) {
+		t.Fatalf("Expected the cursor at 30, got %v", c.Record())
+	}
+	records := tree.FindRange(10, 40)
+	for range 15 {
+		records.Next()
+	}
+
+	// the leaves that the cursor and the iterator were in are merged away, and their pages are freed
+	for val := 20; val < 40; val++ {
+		tree.Delete(val)
+	}
+	if c.Next() || c.Err() != nil {
+		t.Errorf("Expected the cursor to run off the end, got %v and %v", c.Record(), c.Err())
+	}
+	if !c.SeekForPrev(30) || c.Key() != 19 {
+		t.Errorf("Expected the cursor at 19, got %v", c.Record())
+	}
+	if record := records.Next(); record != nil || records.Err() != nil {
+		t.Errorf("Expected the iterator to run off the end, got %v and %v", record, records.Err())
+	}
+
+	records = tree.FindRange(0, 20)
+	records.Next()
+	if _, err := tree.DeleteRange(0, 15); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if keys := collectKeys(records); !slices.Equal(keys, []int{15, 16, 17, 18, 19}) || records.Err() != nil {
+		t.Errorf("Expected the records left after the range, got %v and %v", keys, records.Err())
+	}
+
+	// the pages that were freed can be handed out again, and the tree still takes changes
+	for val := 100; val < 140; val++ {
+		if err := tree.Insert(NewIntRecord(val)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestCursorOfEmptyTree(t *testing.T) {
+	tree := NewTree[int]()
+	c := tree.Cursor()
+	if c.First() || c.Last() || c.Seek(1) || c.SeekForPrev(1) || c.Next() || c.Prev() || c.Valid() {
+		t.Errorf("Expected the cursor to never be at a record")
+	}
+	if c.Record() != nil || c.Key() != 0 {
+		t.Errorf("Expected no record, got %v", c.Record())
+	}
+
+	// a tree that had every record deleted is left with an empty root leaf
+	tree.Insert(NewIntRecord(1))
+	tree.Delete(1)
+	if c.First() || c.Last() {
+		t.Errorf("Expected the cursor to never be at a record")
+	}
+}
+
+func TestCursorAsOf(t *testing.T) {
+	tree := NewTree[int](WithOrder(3), WithVersions())
+	for val := range 20 {
+		tree.Insert(NewIntRecord(val))
+	}
+	version := tree.Version()
+	for val := 5; val < 15; val++ {
+		tree.Delete(val)
+	}
+
+	keys := make([]int, 0)
+	c := tree.Cursor()
+	for ok := c.SeekForPrev(16); ok; ok = c.Prev() {
+		keys = append(keys, c.Key())
+	}
+	if !slices.Equal(keys, []int{16, 15, 4, 3, 2, 1, 0}) {
+		t.Errorf("Expected the deleted keys to be skipped, got %v", keys)
+	}
+
+	keys = keys[:0]
+	c = tree.Cursor(AsOf(version))
+	for ok := c.Seek(3); ok && c.Key() < 8; ok = c.Next() {
+		keys = append(keys, c.Key())
+	}
+	if !slices.Equal(keys, []int{3, 4, 5, 6, 7}) {
+		t.Errorf("Expected the keys as of the earlier version, got %v", keys)
+	}
+}
+
+func TestCursorWhileWriting(t *testing.T) {
+	const maxKey = 2000
+	tree := NewTree[int](WithOrder(3))
+	stable := make([]int, 0)
+	for val := 0; val < maxKey; val += stableKeyStride {
+		tree.Insert(NewIntRecord(val))
+		stable = append(stable, val)
+	}
+
+	done := make(chan struct{})
+	var writers sync.WaitGroup
+	for w := range 4 {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			for range 3000 {
+				val := r.Intn(maxKey)
+				if val%stableKeyStride == 0 {
+					continue
+				}
+				if r.Intn(2) == 0 {
+					tree.Insert(NewIntRecord(val))
+				} else {
+					tree.Delete(val)
+				}
+			}
+		}()
+	}
+
+	var readers sync.WaitGroup
+	for reader := range 4 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				// a walk can miss or see keys that change under it, but has to stay in order and see every stable key once
+				keys := make([]int, 0)
+				c := tree.Cursor()
+				if reader%2 == 0 {
+					for ok := c.First(); ok; ok = c.Next() {
+						keys = append(keys, c.Key())
+					}
+				} else {
+					for ok := c.Last(); ok; ok = c.Prev() {
+						keys = append(keys, c.Key())
+					}
+					slices.Reverse(keys)
+				}
+
+				seenStable := make([]int, 0, len(stable))
+				for i, val := range keys {
+					if i > 0 && val <= keys[i-1] {
+						t.Errorf("Walk was not in order, %d came after %d", val, keys[i-1])
+						return
+					}
+					if val%stableKeyStride == 0 {
+						seenStable = append(seenStable, val)
+					}
+				}
+				if !slices.Equal(seenStable, stable) {
+					t.Errorf("Walk did not see every stable key:\nExpected: %v\nGot: %v", stable, seenStable)
+					return
+				}
+			}
+		}()
+	}
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+	checkLeafLinks(t, tree)
+}
@@ -0,0 +1,136 @@
+package bptree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithValidation has the tree check its whole structure, the way Validate does, after every change to it,
+// as well as after every split and merge along the way, so that a change that breaks the tree is caught in the act
+// The change then fails with an InvariantError, which shows the tree before the change and where it left it
+// Checking the whole tree makes every change take time in proportion to the size of the tree, and writers take the whole tree to themselves,
+// so this is meant for tests and debugging
+func WithValidation() TreeOption {
+	return func(o *treeOptions) {
+		o.validating = true
+	}
+}
+
+// InvariantError is returned by a change to a tree created with WithValidation that left the tree broken
+// Changes that do not return an error panic with it instead
+type InvariantError struct {
+	// the change that broke the tree, and the step within it that was found to break it
+	Operation string
+	// the tree before the change started, and as the step left it
+	Before string
+	After  string
+	// every violation in the tree after the step
+	Err *ValidationError
+}
+
+func (e *InvariantError) Error() string {
+	return fmt.Sprintf("bptree: %s broke the tree, %s\nbefore:\n%safter:\n%s", e.Operation, e.Err.list(), e.Before, e.After)
+}
+
+func (e *InvariantError) Unwrap() error {
+	return e.Err
+}
+
+// the change to a validating tree that is in progress
+type changeInProgress struct {
+	operation string
+	before    string
+}
+
+// start a change to a validating tree, named by the operation and its arguments, and return the check for when it is done
+// the tree has to be locked already, and the check deferred, so that it runs once the change is done
+func (t *Tree[T]) validateChange(operation string, args ...any) func() {
+	if !t.validating {
+		return func() {}
+	}
+
+	names := make([]string, 0, len(args))
+	for _, arg := range args {
+		names = append(names, fmt.Sprint(arg))
+	}
+	t.change = &changeInProgress{
+		operation: fmt.Sprintf("%s(%s)", operation, strings.Join(names, ", ")),
+		before:    t.dump(),
+	}
+
+	return func() {
+		// a change that already failed has its own error to report
+		if r := recover(); r != nil {
+			t.change = nil
+			panic(r)
+		}
+		t.validateStep("")
+		t.change = nil
+	}
+}
+
+// check the whole tree in the middle of a change, once a step of it is done, which is named to show where the tree broke
+func (t *Tree[T]) validateStep(step string) {
+	if !t.validating {
+		return
+	}
+
+	violations := t.validate()
+	if len(violations) == 0 {
+		return
+	}
+
+	failure := &InvariantError{
+		Operation: step,
+		After:     t.dump(),
+		Err:       &ValidationError{Violations: violations},
+	}
+	if change := t.change; change != nil {
+		failure.Before = change.before
+		if step == "" {
+			failure.Operation = change.operation
+		} else {
+			failure.Operation = fmt.Sprintf("%s during %s", step, change.operation)
+		}
+		t.change = nil
+	}
+	panic(failure)
+}
+
+// the keys of every node, one node to a line and indented by depth, along with the parent each node points to when it is not the node above it
+// unlike String, this is safe to call on a broken tree, and in the middle of a change to a stored tree, since it leaves the nodes pinned
+func (t *Tree[T]) dump() string {
+	if t.root == nil {
+		return "(empty)\n"
+	}
+
+	var b strings.Builder
+	seen := make(map[*node[T]]bool)
+	var walk func(n *node[T], parent *node[T], depth int)
+	walk = func(n *node[T], parent *node[T], depth int) {
+		n = t.fetch(n)
+		fmt.Fprintf(&b, "%s%s", strings.Repeat("  ", depth), describeNode(n))
+		if n.parent != parent && (t.store == nil || n.parent != nil) {
+			fmt.Fprintf(&b, " (parent %s)", linkedNode(n.parent))
+		}
+		if seen[n] {
+			b.WriteString(" (seen already)\n")
+			return
+		}
+		seen[n] = true
+		b.WriteString("\n")
+
+		if n.isLeaf || n.numKeys < 0 || n.numKeys > t.maxKeysPerNode {
+			return
+		}
+		for _, ptr := range n.pointers[:n.numKeys+1] {
+			if child, ok := t.follow(ptr, n.level-1); ok && child != nil {
+				walk(child, n, depth+1)
+			} else {
+				fmt.Fprintf(&b, "%s(%T)\n", strings.Repeat("  ", depth+1), ptr)
+			}
+		}
+	}
+	walk(t.root, nil, 0)
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package bptree
+
+import (
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidationOfSoundChanges(t *testing.T) {
+	stored, err := Open[int](filepath.Join(t.TempDir(), "tree.db"), IntRecordCodec{}, WithPageSize(128), WithMemoryBudget(4*128), WithValidation())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stored.Close()
+
+	trees := map[string]*Tree[int]{
+		"order 3":    NewTree[int](WithOrder(3), WithValidation()),
+		"duplicates": NewTree[int](WithOrder(4), WithDuplicates(), WithValidation()),
+		"versions":   NewTree[int](WithOrder(3), WithVersions(), WithValidation()),
+		"stored":     stored,
+	}
+	for name, tree := range trees {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			for range 1500 {
+				val := r.Intn(200)
+				var err error
+				switch r.Intn(10) {
+				case 0:
+					_, err = tree.DeleteRange(val, val+r.Intn(20))
+				case 1, 2, 3, 4:
+					err = tree.Delete(val)
+				default:
+					err = tree.Insert(NewIntRecord(val))
+				}
+				if errors.Is(err, ErrCorrupt) {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			if tree.allowDuplicates {
+				return
+			}
+			tx := tree.Begin()
+			for val := range 50 {
+				tx.Delete(val)
+			}
+			if err := tx.Commit(); err != nil && !errors.Is(err, ErrConflict) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidationCatchesTheChangeThatBreaksTree(t *testing.T) {
+	// the tree is broken far from where the changes are made, so that the first change to be checked finds it
+	brokenTree := func() *Tree[int] {
+		tree := NewTree[int](WithOrder(3), WithValidation())
+		for val := range 30 {
+			tree.Insert(NewIntRecord(val * 10))
+		}
+		last, _ := tree.findLeftmostNode(290, latchNone)
+		last.prev = nil
+		return tree
+	}
+
+	var failure *InvariantError
+	if _, err := brokenTree().Upsert(NewIntRecord(0)); !errors.As(err, &failure) || failure.Operation != "Upsert(0)" {
+		t.Fatalf("Expected the upsert to be blamed, got %v", err)
+	}
+	if !errors.Is(failure, ErrCorrupt) || !strings.Contains(failure.Error(), "links back to nothing") {
+		t.Errorf("Expected the broken link to be reported, got %v", failure)
+	}
+
+	if err := brokenTree().Insert(NewIntRecord(5)); !errors.As(err, &failure) || failure.Operation != "split in insertIntoParentNode during Insert(5)" {
+		t.Fatalf("Expected the split to be blamed, got %v", err)
+	}
+	if strings.Contains(failure.Before, "[0 5]") || !strings.Contains(failure.After, "[0 5]") {
+		t.Errorf("Expected the tree to be shown before and after the insert, got:\n%s\nand:\n%s", failure.Before, failure.After)
+	}
+
+	tree := brokenTree()
+	for val := 0; val < 200; val += 10 {
+		err := tree.Delete(val)
+		if !errors.As(err, &failure) {
+			t.Fatalf("Expected the delete of %d to fail, got %v", val, err)
+		}
+		if strings.HasPrefix(failure.Operation, "merge in coalesce during Delete") {
+			return
+		}
+	}
+	t.Errorf("Expected a merge to be blamed, got %v", failure)
+}
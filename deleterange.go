@@ -0,0 +1,283 @@
+package bptree
+
+// DeleteRange removes every record that satisfies low <= x < high, and returns how many were removed
+//
+// Rather than deleting the records one at a time, the leaves and subtrees that are entirely in the range are cut out of the tree at once,
+// and only the nodes on the paths to either end of the range are rebalanced afterwards
+// On a versioned tree, the keys stay until they are garbage collected, and the whole range is deleted in a single version
+// A range without any records in it is not an error
+func (t *Tree[T]) DeleteRange(low T, high T) (removed int, err error) {
+	defer t.catchCorrupt(&err)
+
+	_, unlock := t.lockTree(latchNone)
+	defer unlock()
+
+	if !t.writable() {
+		return 0, t.notWritable()
+	}
+	if t.isEmpty() || low >= high {
+		return 0, nil
+	}
+	defer t.commitInto(&err)
+	defer t.validateChange("DeleteRange", low, high)()
+
+	if t.versioned {
+		return t.deleteVersionsInRange(low, high), nil
+	}
+
+	removed = t.cutRange(low, high)
+	t.rebalanceRange(low, high)
+	return removed, nil
+}
+
+// mark every record in the range as deleted, all with the same version
+func (t *Tree[T]) deleteVersionsInRange(low T, high T) int {
+	t.versions.batch, t.versions.batchStart = true, t.versions.current
+	defer func() {
+		t.versions.batch = false
+	}()
+
+	leaf, idx, _ := t.findNodeAndIdx(low, latchNone)
+	removed := 0
+	for {
+		for ; idx < leaf.numKeys; idx++ {
+			if leaf.keys[idx] >= high {
+				return removed
+			}
+			if t.recordAt(leaf, idx, latestVersion) != nil {
+				leaf = t.unshare(leaf)
+				t.setRecord(leaf, idx, nil)
+				removed++
+			}
+		}
+
+		next, ok := t.nextLeaf(leaf)
+		if !ok {
+			return removed
+		}
+		leaf, idx = next, 0
+	}
+}
+
+// remove the records in the range from the leaves at either end of it, along with every node in between
+// the nodes on the paths to the two leaves can be left far short of the minimum, or even without any keys
+func (t *Tree[T]) cutRange(low T, high T) int {
+	first, firstIdx, _ := t.findNodeAndIdx(low, latchNone)
+	first = t.unshare(first)
+	last, lastIdx, _ := t.findNodeAndIdx(high, latchNone)
+	last = t.unshare(last)
+
+	if first == last {
+		for range lastIdx - firstIdx {
+			removeKeyAndPointerFromLeaf(first, firstIdx)
+		}
+		t.markDirty(first)
+		t.summarizeUp(first)
+		return lastIdx - firstIdx
+	}
+
+	removed := first.numKeys - firstIdx + lastIdx
+	for first.numKeys > firstIdx {
+		removeKeyAndPointerFromLeaf(first, firstIdx)
+	}
+	for range lastIdx {
+		removeKeyAndPointerFromLeaf(last, 0)
+	}
+	t.markDirty(first, last)
+
+	// the leaves are at the same depth, so the paths up from them meet at the node where the range splits in two
+	// below it, everything to the right of the first path and to the left of the last path is in the range
+	cut := make([]*node[T], 0)
+	left, right := first, last
+	for left.parent != right.parent {
+		leftIdx := t.getNodeIndexInParent(left, left.parent)
+		rightIdx := t.getNodeIndexInParent(right, right.parent)
+		if leftIdx == -1 || rightIdx == -1 {
+			corrupt(left, "could not find node idx")
+		}
+
+		left, right = left.parent, right.parent
+		cut = append(cut, t.removeChildren(left, leftIdx+1, left.numKeys+1)...)
+		cut = append(cut, t.removeChildren(right, 0, rightIdx)...)
+	}
+
+	parent := left.parent
+	leftIdx := t.getNodeIndexInParent(left, parent)
+	rightIdx := t.getNodeIndexInParent(right, parent)
+	if leftIdx == -1 || rightIdx == -1 {
+		corrupt(left, "could not find node idx")
+	}
+	cut = append(cut, t.removeChildren(parent, leftIdx+1, rightIdx)...)
+
+	for _, n := range cut {
+		removed += t.freeSubtree(n)
+	}
+
+	// the leaves in between are gone, so the two leaves are next to each other now
+	first.pointers[t.maxLeafPointers] = t.link(last)
+	t.linkBack(first)
+
+	// the first pass gets the node where the paths meet wrong, which the second pass puts right
+	t.summarizeUp(first)
+	t.summarizeUp(last)
+	return removed
+}
+
+// remove the children of the nonleaf node from the index from up to the index to, and return them in order
+// the separator on the left of the children that are removed is kept, which still bounds the keys on either side of it
+func (t *Tree[T]) removeChildren(n *node[T], from int, to int) []*node[T] {
+	removed := make([]*node[T], 0, max(to-from, 0))
+	if from >= to {
+		return removed
+	}
+
+	for i := from; i < to; i++ {
+		removed = append(removed, t.child(n, i))
+	}
+
+	keys := make([]T, 0, n.numKeys)
+	pointers := make([]interface{}, 0, n.numKeys+1)
+	kept := -1
+	for i, ptr := range n.pointers[:n.numKeys+1] {
+		if i >= from && i < to {
+			continue
+		}
+		if kept != -1 {
+			keys = append(keys, n.keys[kept])
+		}
+		pointers = append(pointers, ptr)
+		kept = i
+	}
+
+	clear(n.keys)
+	clear(n.pointers)
+	copy(n.keys, keys)
+	copy(n.pointers, pointers)
+	n.numKeys = len(keys)
+	t.markDirty(n)
+	return removed
+}
+
+// free the node and every node under it, and return how many records there were in its leaves
+func (t *Tree[T]) freeSubtree(n *node[T]) int {
+	removed := 0
+	if n.isLeaf {
+		removed = n.numKeys
+	} else {
+		for i := range n.numKeys + 1 {
+			removed += t.freeSubtree(t.child(n, i))
+		}
+	}
+
+	t.freeNode(n)
+	return removed
+}
+
+// bring the nodes on the paths to either end of a range that was cut out back up to the minimum number of keys
+// one node is fixed at a time, starting from the bottom, by merging it with a neighbor or taking keys from it
+func (t *Tree[T]) rebalanceRange(low T, high T) {
+	for {
+		t.collapseRoot()
+
+		target := t.deepestShortNode(low, high)
+		if target == nil {
+			return
+		}
+
+		// a node without any keys has no neighbor under the same parent, so the parent has to be fixed first
+		for target.parent.numKeys == 0 {
+			target = target.parent
+		}
+		t.refill(target)
+	}
+}
+
+// while the root is a nonleaf node with a single child, that child becomes the root
+func (t *Tree[T]) collapseRoot() {
+	for !t.root.isLeaf && t.root.numKeys == 0 {
+		root := t.root
+		child := t.child(root, 0)
+		child.parent = nil
+		t.root = child
+		t.freeNode(root)
+	}
+}
+
+// the deepest node on the path to either key that has fewer keys than the minimum, or nil if there is none
+// the root is allowed to go below the minimum, so it is never returned
+func (t *Tree[T]) deepestShortNode(low T, high T) *node[T] {
+	paths := make([][]*node[T], 0, 2)
+	for _, val := range []T{low, high} {
+		path := make([]*node[T], 0)
+		n := t.fetch(t.root)
+		for {
+			path = append(path, n)
+			if n.isLeaf {
+				break
+			}
+
+			ptrIdx := n.numKeys
+			for i, key := range n.keys[:n.numKeys] {
+				if val <= key {
+					ptrIdx = i
+					break
+				}
+			}
+			n = t.child(n, ptrIdx)
+		}
+		paths = append(paths, path)
+	}
+
+	for depth := len(paths[0]) - 1; depth > 0; depth-- {
+		for _, path := range paths {
+			n := path[depth]
+			if (n.isLeaf && n.numKeys < t.minLeafKeys) || (!n.isLeaf && n.numKeys < t.minNonLeafKeys) {
+				return n
+			}
+		}
+	}
+	return nil
+}
+
+// bring a node that is short of keys up to the minimum, whose parent has at least one other child
+// unlike deleteCleanup, the node can be short by more than one key, and a merge does not rebalance the parent straight away
+// neither a merge nor moving keys changes what is under the parent, so only the two nodes have to be summarized again
+func (t *Tree[T]) refill(targetNode *node[T]) {
+	targetNode = t.unshare(targetNode)
+	parent := targetNode.parent
+	targetNodeIdxInParent := t.getNodeIndexInParent(targetNode, parent)
+	if targetNodeIdxInParent == -1 {
+		corrupt(targetNode, "could not find node idx")
+	}
+
+	neighborNode, neighborNodeIdx, separatorKeyIdx := t.neighborOf(targetNode, targetNodeIdxInParent)
+	separator := parent.keys[separatorKeyIdx]
+
+	if targetNode.numKeys+neighborNode.numKeys <= t.mergedCapacity(targetNode) {
+		left, right, rightIdx := neighborNode, targetNode, targetNodeIdxInParent
+		if targetNodeIdxInParent == 0 {
+			left, right, rightIdx = targetNode, neighborNode, neighborNodeIdx
+		}
+
+		t.merge(left, right, separator)
+		removeKeyAndPointerFromNonLeaf(parent, rightIdx)
+		t.markDirty(parent)
+		return
+	}
+
+	// the two have more keys between them than fit in one node, so the neighbor can spare enough to bring the node up to the minimum
+	minKeys := t.minNonLeafKeys
+	if targetNode.isLeaf {
+		minKeys = t.minLeafKeys
+	}
+	for targetNode.numKeys < minKeys {
+		if targetNodeIdxInParent != 0 {
+			t.redistributeNodes(neighborNode, targetNode, parent, targetNodeIdxInParent, separatorKeyIdx)
+		} else {
+			t.redistributeNodes(targetNode, neighborNode, parent, targetNodeIdxInParent, separatorKeyIdx)
+		}
+	}
+	t.markDirty(targetNode, neighborNode, parent)
+	t.summarize(targetNode)
+	t.summarize(neighborNode)
+}
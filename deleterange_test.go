@@ -0,0 +1,235 @@
+package bptree
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// check that every leaf is at the same depth, that no node other than the root is short of keys,
+// and that the keys under each child are between the separators on either side of it
+func checkShape(t *testing.T, tree *Tree[int]) {
+	t.Helper()
+	if tree.root == nil {
+		return
+	}
+	if !tree.root.isLeaf && tree.root.numKeys == 0 {
+		t.Fatalf("Root has a single child")
+	}
+
+	defer tree.release()
+	leafDepth := -1
+	var walk func(n *node[int], depth int, low *int, high *int)
+	walk = func(n *node[int], depth int, low *int, high *int) {
+		n = tree.fetch(n)
+		keys := n.keys[:n.numKeys]
+		if !slices.IsSorted(keys) {
+			t.Fatalf("Keys %v are out of order", keys)
+		}
+		for _, key := range keys {
+			if (low != nil && key < *low) || (high != nil && key > *high) {
+				t.Fatalf("Key %d of %v is outside of its separators", key, keys)
+			}
+		}
+
+		if n.isLeaf {
+			if leafDepth == -1 {
+				leafDepth = depth
+			} else if depth != leafDepth {
+				t.Fatalf("Leaf %v is at depth %d, expected %d", keys, depth, leafDepth)
+			}
+			if n != tree.root && n.numKeys < tree.minLeafKeys {
+				t.Fatalf("Leaf %v is short of keys", keys)
+			}
+			return
+		}
+
+		if n != tree.root && n.numKeys < tree.minNonLeafKeys {
+			t.Fatalf("Node %v is short of keys", keys)
+		}
+		for i := range n.numKeys + 1 {
+			childLow, childHigh := low, high
+			if i > 0 {
+				childLow = &n.keys[i-1]
+			}
+			if i < n.numKeys {
+				childHigh = &n.keys[i]
+			}
+			walk(tree.child(n, i), depth+1, childLow, childHigh)
+		}
+	}
+	walk(tree.root, 0, nil, nil)
+
+	// the nodes of a stored tree are linked by page, which only Validate follows
+	if tree.store != nil {
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return
+	}
+	checkParents(t, tree.root)
+	checkLeafLinks(t, tree)
+}
+
+func TestDeleteRangeMatchesModel(t *testing.T) {
+	for _, order := range []int{3, 4, 5, 8} {
+		for _, duplicates := range []bool{false, true} {
+			t.Run(fmt.Sprintf("order %d, duplicates %v", order, duplicates), func(t *testing.T) {
+				opts := []TreeOption{WithOrder(order), WithCounts()}
+				if duplicates {
+					opts = append(opts, WithDuplicates())
+				}
+				tree := NewTree[int](opts...)
+				records := make([]*labelledRecord, 0)
+				r := rand.New(rand.NewSource(int64(order)))
+
+				for round := range 200 {
+					for range r.Intn(60) {
+						record := &labelledRecord{r.Intn(500), fmt.Sprint(len(records))}
+						if tree.Insert(record) == nil {
+							records = append(records, record)
+						}
+					}
+
+					low := r.Intn(520) - 10
+					high := low + r.Intn(200)
+					if r.Intn(10) == 0 {
+						low, high = -1, 1000
+					}
+
+					kept := slices.DeleteFunc(slices.Clone(records), func(record *labelledRecord) bool {
+						return record.key >= low && record.key < high
+					})
+					if removed, _ := tree.DeleteRange(low, high); removed != len(records)-len(kept) {
+						t.Fatalf("Round %d: expected DeleteRange(%d, %d) to remove %d records, got %d", round, low, high, len(records)-len(kept), removed)
+					}
+					records = kept
+
+					if found, expected := seqLabels(tree.All()), modelOrder(records); !slices.Equal(found, expected) {
+						t.Fatalf("Round %d: expected %v after DeleteRange(%d, %d), got %v", round, expected, low, high, found)
+					}
+					checkShape(t, tree)
+					checkCounts(t, tree)
+				}
+			})
+		}
+	}
+}
+
+func TestDeleteRangeOfEmptyRange(t *testing.T) {
+	tree := NewTree[int](WithOrder(3))
+	if removed, err := tree.DeleteRange(0, 10); removed != 0 || err != nil {
+		t.Errorf("Expected nothing to be removed from an empty tree, got %d and %v", removed, err)
+	}
+
+	for val := range 20 {
+		tree.Insert(NewIntRecord(val))
+	}
+	for _, keys := range [][2]int{{5, 5}, {10, 5}, {30, 40}, {-10, 0}} {
+		if removed, _ := tree.DeleteRange(keys[0], keys[1]); removed != 0 {
+			t.Errorf("Expected DeleteRange(%d, %d) to remove nothing, got %d", keys[0], keys[1], removed)
+		}
+	}
+	if found := collectKeys(tree.FindRange(0, 20)); len(found) != 20 {
+		t.Errorf("Expected every key to be left, got %v", found)
+	}
+}
+
+func TestDeleteRangeMovesIterators(t *testing.T) {
+	tree := NewTree[int](WithOrder(3))
+	for val := range 100 {
+		tree.Insert(NewIntRecord(val))
+	}
+
+	forward, backward := tree.FindRange(0, 100), tree.FindRangeReverse(100, 0)
+	for range 20 {
+		forward.Next()
+		backward.Next()
+	}
+
+	tree.DeleteRange(10, 90)
+	if found := collectKeys(forward); !slices.Equal(found, []int{90, 91, 92, 93, 94, 95, 96, 97, 98, 99}) {
+		t.Errorf("Expected the iterator to carry on past the range, got %v", found)
+	}
+	if found := collectKeys(backward); !slices.Equal(found, []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}) {
+		t.Errorf("Expected the reverse iterator to carry on past the range, got %v", found)
+	}
+}
+
+func TestDeleteRangeOfVersions(t *testing.T) {
+	tree := NewTree[int](WithOrder(3), WithVersions())
+	for val := range 50 {
+		tree.Insert(NewIntRecord(val))
+	}
+	tree.Delete(20)
+	before := tree.Version()
+
+	if removed, _ := tree.DeleteRange(10, 30); removed != 19 {
+		t.Errorf("Expected 19 records to be removed, got %d", removed)
+	}
+	if tree.Version() != before+1 {
+		t.Errorf("Expected the range to be deleted in a single version, got %d after %d", tree.Version(), before)
+	}
+	if found := collectKeys(tree.FindRange(8, 32)); !slices.Equal(found, []int{8, 9, 30, 31}) {
+		t.Errorf("Expected the range to be gone, got %v", found)
+	}
+	if found := collectKeys(tree.FindRange(18, 22, AsOf(before))); !slices.Equal(found, []int{18, 19, 21}) {
+		t.Errorf("Expected the range to still be there as of the earlier version, got %v", found)
+	}
+}
+
+func TestDeleteRangeLeavesSnapshot(t *testing.T) {
+	tree := NewTree[int](WithOrder(3))
+	for val := range 100 {
+		tree.Insert(NewIntRecord(val))
+	}
+
+	snapshot := tree.Snapshot()
+	defer snapshot.Close()
+	tree.DeleteRange(20, 80)
+
+	if found := collectKeys(snapshot.FindRange(0, 100)); len(found) != 100 {
+		t.Errorf("Expected the snapshot to keep every key, got %v", found)
+	}
+	if found := collectKeys(tree.FindRange(15, 85)); !slices.Equal(found, []int{15, 16, 17, 18, 19, 80, 81, 82, 83, 84}) {
+		t.Errorf("Expected the range to be gone, got %v", found)
+	}
+	checkShape(t, tree)
+}
+
+func TestDeleteRangeOfStoredTree(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := Open[int](path, IntRecordCodec{}, WithPageSize(128), WithMemoryBudget(4*128))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for val := range 300 {
+		tree.Insert(NewIntRecord(val))
+	}
+	if removed, _ := tree.DeleteRange(50, 250); removed != 200 {
+		t.Errorf("Expected 200 records to be removed, got %d", removed)
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// the freed pages are reused once the tree grows again
+	tree, err = Open[int](path, IntRecordCodec{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+
+	expected := make([]int, 0)
+	for val := range 300 {
+		if val < 50 || val >= 250 {
+			expected = append(expected, val)
+		}
+	}
+	if found := treeKeys(tree); !slices.Equal(found, expected) {
+		t.Errorf("Expected the range to be gone after reopening, got %v", found)
+	}
+	checkShape(t, tree)
+}
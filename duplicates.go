@@ -0,0 +1,62 @@
+package bptree
+
+// FindAll iterates over every record stored under the key, in the order they were inserted
+// On a tree without duplicates, there is at most one
+func (t *Tree[T]) FindAll(val T, opts ...ReadOption) Iterator[T] {
+	return t.scan(KeyRange[T]{Low: Inclusive(val), High: Inclusive(val)}, opts, false)
+}
+
+// DeleteRecord removes this exact record from the tree, rather than any record with the same key
+// Records are matched with ==, so the record type must be comparable, like a pointer
+// If the record is not in the tree, ErrNotFound is returned, or ErrEmpty if the tree has no records at all
+func (t *Tree[T]) DeleteRecord(record Record[T]) (err error) {
+	defer t.catchCorrupt(&err)
+
+	// the run of equal keys can span leaves outside of the latched path
+	mode := latchDelete
+	if t.allowDuplicates {
+		mode = latchNone
+	}
+	mode, unlock := t.lockTree(mode)
+	defer unlock()
+
+	if !t.writable() {
+		return t.notWritable()
+	}
+	if t.isEmpty() {
+		return ErrEmpty
+	}
+	defer t.commitInto(&err)
+	defer t.validateChange("DeleteRecord", record)()
+
+	val := record.GetHashableVal()
+	leaf, idx, latches := t.findFirst(val, mode)
+	defer latches.release()
+
+	// walk the run of equal keys, which can span several leaves
+	for leaf != nil {
+		for ; idx < leaf.numKeys; idx++ {
+			if leaf.keys[idx] != val {
+				return notFound(val)
+			}
+
+			if t.recordAt(leaf, idx, latestVersion) == record {
+				t.deleteAt(leaf, idx)
+				return nil
+			}
+		}
+
+		// without duplicates, there is only ever the one record with the key
+		if !t.allowDuplicates {
+			return notFound(val)
+		}
+
+		next, ok := t.nextLeaf(leaf)
+		if !ok {
+			return notFound(val)
+		}
+		leaf, idx = next, 0
+	}
+
+	return notFound(val)
+}
@@ -0,0 +1,117 @@
+package bptree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func collectLabels(records Iterator[int]) []string {
+	labels := make([]string, 0)
+	for rec := records.Next(); rec != nil; rec = records.Next() {
+		labels = append(labels, rec.String())
+	}
+	return labels
+}
+
+func TestDuplicatesSpanningLeaves(t *testing.T) {
+	tree := NewTree[int](WithDuplicates())
+
+	expected := make([]string, 0)
+	tree.Insert(&labelledRecord{1, "1"})
+	tree.Insert(&labelledRecord{9, "9"})
+	for i := range 10 {
+		label := fmt.Sprintf("5-%d", i)
+		if err := tree.Insert(&labelledRecord{5, label}); err != nil {
+			t.Fatalf("Expected duplicate %s to be inserted, got %v", label, err)
+		}
+		expected = append(expected, label)
+	}
+
+	if found := collectLabels(tree.FindAll(5)); !slices.Equal(found, expected) {
+		t.Errorf("Expected all duplicates in insertion order:\nExpected: %v\nGot: %v", expected, found)
+	}
+	if found := collectLabels(tree.FindAll(4)); len(found) != 0 {
+		t.Errorf("Expected no records for a missing key, got %v", found)
+	}
+	if record, _ := tree.FindPoint(5); record.String() != "5-0" {
+		t.Errorf("Expected FindPoint to return the first duplicate, got %v", record)
+	}
+
+	all := collectLabels(tree.FindRange(0, 10))
+	if len(all) != 12 || all[0] != "1" || all[11] != "9" {
+		t.Errorf("Expected the range to contain every duplicate, got %v", all)
+	}
+}
+
+func TestDuplicatesDeleteRecord(t *testing.T) {
+	tree := NewTree[int](WithDuplicates())
+
+	records := make([]*labelledRecord, 0)
+	for i := range 8 {
+		record := &labelledRecord{7, fmt.Sprintf("7-%d", i)}
+		records = append(records, record)
+		tree.Insert(record)
+	}
+
+	if err := tree.DeleteRecord(&labelledRecord{7, "7-3"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a different record with the same key to not be deleted, got %v", err)
+	}
+	if err := tree.DeleteRecord(records[6]); err != nil {
+		t.Errorf("Expected %v to be deleted, got %v", records[6], err)
+	}
+	if err := tree.DeleteRecord(records[6]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected %v to already be deleted, got %v", records[6], err)
+	}
+	if err := tree.Delete(7); err != nil {
+		t.Errorf("Expected a record with key 7 to be deleted, got %v", err)
+	}
+
+	expected := []string{"7-1", "7-2", "7-3", "7-4", "7-5", "7-7"}
+	if found := collectLabels(tree.FindAll(7)); !slices.Equal(found, expected) {
+		t.Errorf("Expected: %v\nGot: %v", expected, found)
+	}
+}
+
+func TestDuplicatesRandomOperations(t *testing.T) {
+	for _, order := range []int{3, 4, 7} {
+		tree := NewTree[int](WithOrder(order), WithDuplicates())
+		r := rand.New(rand.NewSource(int64(order)))
+
+		// every record that is currently in the tree, per key
+		expected := make(map[int][]*labelledRecord)
+		for i := range 4000 {
+			key := r.Intn(20)
+			if r.Intn(3) == 0 && len(expected[key]) > 0 {
+				victim := r.Intn(len(expected[key]))
+				if err := tree.DeleteRecord(expected[key][victim]); err != nil {
+					t.Fatalf("Order %d: expected %v to be deleted, got %v", order, expected[key][victim], err)
+				}
+				expected[key] = slices.Delete(expected[key], victim, victim+1)
+			} else {
+				record := &labelledRecord{key, fmt.Sprintf("%d-%d", key, i)}
+				tree.Insert(record)
+				expected[key] = append(expected[key], record)
+			}
+		}
+
+		allExpected := make([]string, 0)
+		for key := range 20 {
+			keyExpected := make([]string, 0)
+			for _, record := range expected[key] {
+				keyExpected = append(keyExpected, record.label)
+			}
+			allExpected = append(allExpected, keyExpected...)
+
+			if found := collectLabels(tree.FindAll(key)); !slices.Equal(found, keyExpected) {
+				t.Errorf("Order %d, key %d:\nExpected: %v\nGot: %v", order, key, keyExpected, found)
+			}
+		}
+
+		if found := collectLabels(tree.FindRange(0, 20)); !slices.Equal(found, allExpected) {
+			t.Errorf("Order %d, full range:\nExpected: %v\nGot: %v", order, allExpected, found)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package bptree
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when there is no record with the key, or at the position, that an operation looks for
+	ErrNotFound = errors.New("bptree: record not found")
+	// ErrEmpty is returned when an operation looks for a record in a tree without any, and matches ErrNotFound as well
+	ErrEmpty error = emptyError{}
+	// ErrDuplicate is returned when a record is inserted with a key that is already in a tree that does not allow duplicates
+	ErrDuplicate = errors.New("bptree: duplicate key")
+	// ErrCorrupt is matched by every CorruptError
+	ErrCorrupt = errors.New("bptree: tree is corrupt")
+	// ErrUnsupported is returned by an operation that needs an option the tree was not created with, such as reading as of a version
+	ErrUnsupported = errors.New("bptree: operation not supported by the tree")
+)
+
+type emptyError struct{}
+
+func (emptyError) Error() string {
+	return "bptree: tree is empty"
+}
+
+func (emptyError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// CorruptError is returned when an operation finds that the structure of the tree is broken
+// The tree cannot be trusted after that, and should be rebuilt from its records
+type CorruptError struct {
+	// what the operation found to be wrong
+	Reason string
+	// the keys of each node from the root down to the node where it went wrong
+	Path []string
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("bptree: tree is corrupt: %s, at %s", e.Reason, strings.Join(e.Path, " > "))
+}
+
+func (e *CorruptError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// stop the operation that found the tree to be broken at the node, which is turned into a CorruptError by catchCorrupt
+// the node can be nil if there is no node to blame
+func corrupt[T cmp.Ordered](n *node[T], reason string) {
+	path := make([]string, 0)
+	for ; n != nil; n = n.parent {
+		path = append(path, describeNode(n))
+	}
+	slices.Reverse(path)
+
+	panic(&CorruptError{Reason: reason, Path: path})
+}
+
+// how a node is shown in the path of a CorruptError
+func describeNode[T cmp.Ordered](n *node[T]) string {
+	// the keys of a node of a stored tree are only there while it is resident
+	if n.numKeys < 0 || n.numKeys > len(n.keys) {
+		return fmt.Sprintf("page %d", n.pageID)
+	}
+	return fmt.Sprint(n.keys[:n.numKeys])
+}
+
+// deferred by every operation that returns an error, to return the error for a tree found to be broken rather than panic,
+// including a change to a tree created with WithValidation that broke it
+// a tree stored in a file that fails to read a node or is closed, and a read of a version that is gone, stop the operation in the same way
+func (t *Tree[T]) catchCorrupt(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	if corruptErr, ok := r.(error); ok && (errors.Is(corruptErr, ErrCorrupt) || errors.Is(corruptErr, ErrVersionGone)) {
+		*err = corruptErr
+		return
+	}
+	if storeErr, ok := r.(error); ok && t.store != nil && (storeErr == t.store.err || storeErr == ErrClosed) {
+		*err = storeErr
+		return
+	}
+	panic(r)
+}
+
+// the error for a change to a tree that cannot take any
+func (t *Tree[T]) notWritable() error {
+	if t.store.err != nil {
+		return t.store.err
+	}
+	return ErrClosed
+}
+
+// the error for a key that is not in the tree
+func notFound[T cmp.Ordered](val T) error {
+	return fmt.Errorf("%w: %v", ErrNotFound, val)
+}
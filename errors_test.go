@@ -0,0 +1,226 @@
+package bptree
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestErrorsOfEmptyTree(t *testing.T) {
+	tree := NewTree[int]()
+
+	if record, err := tree.FindPoint(1); record != nil || !errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrEmpty from FindPoint on an empty tree, got %v and %v", record, err)
+	}
+	if err := tree.Delete(1); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrEmpty from Delete on an empty tree, got %v", err)
+	}
+	if err := tree.DeleteRecord(NewIntRecord(1)); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrEmpty from DeleteRecord on an empty tree, got %v", err)
+	}
+	if !errors.Is(ErrEmpty, ErrNotFound) {
+		t.Errorf("Expected ErrEmpty to match ErrNotFound")
+	}
+
+	// scans of an empty tree have nothing to return
+	if found := collectKeys(tree.FindRange(0, 10)); len(found) != 0 {
+		t.Errorf("Expected no records, got %v", found)
+	}
+	if found := collectKeys(tree.ScanReverse(KeyRange[int]{})); len(found) != 0 {
+		t.Errorf("Expected no records, got %v", found)
+	}
+	if found := collectKeys(tree.FindAll(1)); len(found) != 0 {
+		t.Errorf("Expected no records, got %v", found)
+	}
+}
+
+func TestErrorsOfMissingAndDuplicateKeys(t *testing.T) {
+	tree := NewTree[int](WithOrder(3))
+	for val := range 10 {
+		if err := tree.Insert(NewIntRecord(val)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if err := tree.Insert(NewIntRecord(5)); !errors.Is(err, ErrDuplicate) || err.Error() != "bptree: duplicate key: 5" {
+		t.Errorf("Expected ErrDuplicate with the key, got %v", err)
+	}
+	if _, err := tree.FindPoint(20); !errors.Is(err, ErrNotFound) || errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := tree.Delete(20); !errors.Is(err, ErrNotFound) || err.Error() != "bptree: record not found: 20" {
+		t.Errorf("Expected ErrNotFound with the key, got %v", err)
+	}
+	if err := tree.Delete(5); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := tree.Delete(5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a key that was deleted, got %v", err)
+	}
+}
+
+func TestErrorsOfCorruptTree(t *testing.T) {
+	tree := NewTree[int](WithOrder(3))
+	for val := range 20 {
+		tree.Insert(NewIntRecord(val * 10))
+	}
+
+	// a leaf that holds something other than a record
+	leaf, _ := tree.findLeftmostNode(0, latchNone)
+	leaf.pointers[0] = "not a record"
+
+	_, err := tree.FindPoint(0)
+	var corruptErr *CorruptError
+	if !errors.Is(err, ErrCorrupt) || !errors.As(err, &corruptErr) {
+		t.Fatalf("Expected a CorruptError, got %v", err)
+	}
+	depth := 0
+	for n := leaf; n != nil; n = n.parent {
+		depth++
+	}
+	if len(corruptErr.Path) != depth || corruptErr.Path[len(corruptErr.Path)-1] != "[0 10]" {
+		t.Errorf("Expected the path to end at the leaf, got %v", corruptErr.Path)
+	}
+
+	// a loop has nowhere to return the error, so it ends and leaves it for Err
+	for range tree.All() {
+		t.Errorf("Expected the loop to end at the broken leaf")
+	}
+	if err := tree.Err(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt from Err after the loop, got %v", err)
+	}
+	for range tree.Range(100, 120) {
+	}
+	if err := tree.Err(); err != nil {
+		t.Errorf("Expected no error once a loop ran to its end, got %v", err)
+	}
+
+	// a node whose parent does not point back to it is found when it splits
+	tree = NewTree[int](WithOrder(3))
+	for val := range 20 {
+		tree.Insert(NewIntRecord(val * 10))
+	}
+	leaf, _ = tree.findLeftmostNode(190, latchNone)
+	leaf.parent = tree.fetch(tree.root.pointers[0].(*node[int]))
+
+	err = nil
+	for val := 191; val < 200 && err == nil; val++ {
+		err = tree.Insert(NewIntRecord(val))
+	}
+	if !errors.As(err, &corruptErr) || corruptErr.Reason != "could not find node idx" {
+		t.Fatalf("Expected a CorruptError for the split, got %v", err)
+	}
+
+	// the operation does not leave anything latched behind
+	if found := collectKeys(tree.FindRange(0, 30)); !slices.Equal(found, []int{0, 10, 20}) {
+		t.Errorf("Expected the tree to still be readable, got %v", found)
+	}
+}
+
+func TestErrorsOfClosedTree(t *testing.T) {
+	tree, err := Open[int](filepath.Join(t.TempDir(), "tree.db"), IntRecordCodec{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tree.Insert(NewIntRecord(1))
+	if err := tree.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := tree.Insert(NewIntRecord(2)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Insert, got %v", err)
+	}
+	if err := tree.Delete(1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Delete, got %v", err)
+	}
+	if _, err := tree.DeleteRange(0, 10); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from DeleteRange, got %v", err)
+	}
+
+	if _, err := tree.FindPoint(1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from FindPoint, got %v", err)
+	}
+	if _, err := tree.Min(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Min, got %v", err)
+	}
+	if err := tree.Validate(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Validate, got %v", err)
+	}
+	if s := tree.String(); s != ErrClosed.Error() {
+		t.Errorf("Expected the error in place of the tree, got %q", s)
+	}
+	if records := tree.FindRange(0, 10); records.Next() != nil || !errors.Is(records.Err(), ErrClosed) {
+		t.Errorf("Expected ErrClosed from the iterator, got %v", records.Err())
+	}
+	if c := tree.Cursor(); c.First() || !errors.Is(c.Err(), ErrClosed) {
+		t.Errorf("Expected ErrClosed from the cursor, got %v", c.Err())
+	}
+}
+
+func TestErrorsOfUnreadableTree(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := Open[int](path, IntRecordCodec{}, WithPageSize(128))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for val := range 100 {
+		tree.Insert(NewIntRecord(val))
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tree, err = Open[int](path, IntRecordCodec{}, WithPageSize(128))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+
+	// once the tree is open, every leaf that is not in memory yet fails its checksum
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for page := 128; page < len(data); page += 128 {
+		if data[page+4] == pageTypeLeaf {
+			data[page+20] ^= 0xff
+		}
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	records := tree.FindRange(50, 60)
+	if record := records.Next(); record != nil || !errors.Is(records.Err(), ErrCorruptPage) {
+		t.Errorf("Expected the iterator to stop with ErrCorruptPage, got %v and %v", record, records.Err())
+	}
+	for record := range tree.Backward() {
+		t.Errorf("Expected the loop to end before any record, got %v", record)
+	}
+	if !errors.Is(tree.Err(), ErrCorruptPage) {
+		t.Errorf("Expected the tree to keep the error, got %v", tree.Err())
+	}
+
+	c := tree.Cursor()
+	if c.Last() || !errors.Is(c.Err(), ErrCorruptPage) {
+		t.Errorf("Expected the cursor to stop with ErrCorruptPage, got %v", c.Err())
+	}
+	if s := tree.String(); !strings.Contains(s, ErrCorruptPage.Error()) {
+		t.Errorf("Expected the error in place of the tree, got %q", s)
+	}
+
+	tx := tree.Begin()
+	defer tx.Rollback()
+	if record, err := tx.FindPoint(90); record != nil || !errors.Is(err, ErrCorruptPage) {
+		t.Errorf("Expected ErrCorruptPage from the transaction's FindPoint, got %v and %v", record, err)
+	}
+	if err := tx.Insert(NewIntRecord(200)); !errors.Is(err, ErrCorruptPage) {
+		t.Errorf("Expected ErrCorruptPage from the transaction's Insert, got %v", err)
+	}
+	if err := tx.Delete(90); !errors.Is(err, ErrCorruptPage) {
+		t.Errorf("Expected ErrCorruptPage from the transaction's Delete, got %v", err)
+	}
+}
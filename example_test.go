@@ -0,0 +1,37 @@
+package bptree_test
+
+import (
+	"errors"
+	"fmt"
+
+	bptree "github.com/SleepyWoodpecker/B-Plus"
+)
+
+func Example() {
+	tree := bptree.NewTree[int](bptree.WithOrder(4))
+	for _, val := range []int{5, 1, 4, 2, 3} {
+		tree.Insert(bptree.NewIntRecord(val))
+	}
+
+	record, err := tree.FindPoint(4)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(record)
+
+	if _, err := tree.FindPoint(6); errors.Is(err, bptree.ErrNotFound) {
+		fmt.Println(err)
+	}
+
+	records := tree.FindRange(2, 5)
+	for record := records.Next(); record != nil; record = records.Next() {
+		fmt.Print(record, " ")
+	}
+	fmt.Println()
+
+	// Output:
+	// 4
+	// bptree: record not found: 6
+	// 2 3 4
+}
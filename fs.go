@@ -0,0 +1,61 @@
+package bptree
+
+import (
+	"io"
+	"os"
+)
+
+// File is the part of a file that a tree stored on disk needs
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+
+	// Sync makes every write so far durable
+	Sync() error
+	Truncate(size int64) error
+	Size() (int64, error)
+	Close() error
+}
+
+// FS opens the files that a tree is stored in
+// It can be swapped out with WithFS, for example to inject faults in tests
+type FS interface {
+	// OpenFile opens the file for reading and writing
+	// If the file does not exist, it is created when create is set, and an error wrapping os.ErrNotExist is returned otherwise
+	OpenFile(name string, create bool) (File, error)
+}
+
+// OSFS opens files from the operating system, and is what trees use unless WithFS is given
+type OSFS struct{}
+
+func (OSFS) OpenFile(name string, create bool) (File, error) {
+	flag := os.O_RDWR
+	if create {
+		flag |= os.O_CREATE
+	}
+
+	file, err := os.OpenFile(name, flag, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return osFile{file}, nil
+}
+
+type osFile struct {
+	*os.File
+}
+
+func (f osFile) Size() (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// WithFS sets the file system that a tree opened with Open uses
+func WithFS(fs FS) TreeOption {
+	return func(o *treeOptions) {
+		o.fs = fs
+	}
+}
@@ -1,3 +1,3 @@
-module bptree
+module github.com/SleepyWoodpecker/B-Plus
 
 go 1.25.4
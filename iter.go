@@ -0,0 +1,115 @@
+package bptree
+
+import (
+	"cmp"
+	"iter"
+)
+
+// All iterates over every record in the tree, in ascending key order
+// Like the iterators from FindRange, it does not hold the tree in between records, so it is fine to break out of the loop early
+// If the tree turns out to be broken, or a tree stored in a file fails to read a node, the loop ends early, and Err returns why
+func (t *Tree[T]) All() iter.Seq[Record[T]] {
+	return t.seq(func() Iterator[T] {
+		return t.newRangeIterator(KeyRange[T]{}, latestVersion, false)
+	})
+}
+
+// Range iterates over the records that satisfy low <= x < high, in ascending key order
+func (t *Tree[T]) Range(low T, high T) iter.Seq[Record[T]] {
+	return t.seq(func() Iterator[T] {
+		return t.newRangeIterator(halfOpen(low, high), latestVersion, false)
+	})
+}
+
+// From iterates over the records with a key that is not less than start, in ascending key order
+func (t *Tree[T]) From(start T) iter.Seq[Record[T]] {
+	return t.seq(func() Iterator[T] {
+		return t.newRangeIterator(KeyRange[T]{Low: Inclusive(start)}, latestVersion, false)
+	})
+}
+
+// the iterator is only started once the loop runs, and never on an empty tree
+func (t *Tree[T]) seq(newIterator func() Iterator[T]) iter.Seq[Record[T]] {
+	return func(yield func(Record[T]) bool) {
+		// the loop has nowhere to return an error, so it is left for Err
+		var err error
+		defer func() {
+			t.loopErr.Store(&err)
+		}()
+
+		records := func() Iterator[T] {
+			_, unlock := t.lockTree(latchRead)
+			defer unlock()
+			defer t.release()
+
+			if t.isEmpty() {
+				return nil
+			}
+			return newIterator()
+		}()
+		if records == nil {
+			return
+		}
+
+		for record := records.Next(); record != nil; record = records.Next() {
+			if !yield(record) {
+				return
+			}
+		}
+		err = records.Err()
+	}
+}
+
+// Backward iterates over every record in the tree, in descending key order
+// Records with equal keys come in the reverse of the order they were inserted in
+func (t *Tree[T]) Backward() iter.Seq[Record[T]] {
+	return t.seq(func() Iterator[T] {
+		return t.newRangeIterator(KeyRange[T]{}, latestVersion, true)
+	})
+}
+
+// All iterates over every pair in the map, in ascending key order
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return mapSeq[K, V](m.tree.All())
+}
+
+// From iterates over the pairs with a key that is not less than start, in ascending key order
+func (m *Map[K, V]) From(start K) iter.Seq2[K, V] {
+	return mapSeq[K, V](m.tree.From(start))
+}
+
+// Backward iterates over every pair in the map, in descending key order
+func (m *Map[K, V]) Backward() iter.Seq2[K, V] {
+	return mapSeq[K, V](m.tree.Backward())
+}
+
+// Err returns the error that ended the latest loop over All, From or Backward early, or nil if it did not end early
+func (m *Map[K, V]) Err() error {
+	return m.tree.Err()
+}
+
+// All iterates over the pairs the iterator has left, so that a range can be used in a for loop
+//
+//	for key, value := range m.Range(low, high).All() {
+//		...
+//	}
+func (it *MapIterator[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+func mapSeq[K cmp.Ordered, V any](records iter.Seq[Record[K]]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for record := range records {
+			entry := record.(*mapEntry[K, V])
+			if !yield(entry.key, entry.value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package bptree
+
+import (
+	"fmt"
+	"iter"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func seqLabels(records iter.Seq[Record[int]]) []string {
+	labels := make([]string, 0)
+	for record := range records {
+		labels = append(labels, record.String())
+	}
+	return labels
+}
+
+func TestSeqsMatchIterators(t *testing.T) {
+	for _, duplicates := range []bool{false, true} {
+		opts := []TreeOption{WithOrder(3)}
+		if duplicates {
+			opts = append(opts, WithDuplicates())
+		}
+		tree := NewTree[int](opts...)
+		r := rand.New(rand.NewSource(1))
+		for i := range 300 {
+			tree.Insert(&labelledRecord{r.Intn(100), fmt.Sprint(i)})
+		}
+		for range 100 {
+			tree.Delete(r.Intn(100))
+		}
+
+		all := collectLabels(tree.FindRange(-1, 100))
+		if found := seqLabels(tree.All()); !slices.Equal(found, all) {
+			t.Errorf("Expected All to match FindRange:\nExpected: %v\nGot: %v", all, found)
+		}
+
+		// equal keys come out in the reverse of the order they were inserted in, like everything else
+		backward := slices.Clone(all)
+		slices.Reverse(backward)
+		if found := seqLabels(tree.Backward()); !slices.Equal(found, backward) {
+			t.Errorf("Expected Backward to be All reversed:\nExpected: %v\nGot: %v", backward, found)
+		}
+
+		for range 20 {
+			low := r.Intn(110) - 5
+			high := low + r.Intn(40)
+			expected := collectLabels(tree.FindRange(low, high))
+			if found := seqLabels(tree.Range(low, high)); !slices.Equal(found, expected) {
+				t.Errorf("Expected Range(%d, %d) to match FindRange:\nExpected: %v\nGot: %v", low, high, expected, found)
+			}
+
+			expected = collectLabels(tree.FindRange(low, 100))
+			if found := seqLabels(tree.From(low)); !slices.Equal(found, expected) {
+				t.Errorf("Expected From(%d) to match FindRange:\nExpected: %v\nGot: %v", low, expected, found)
+			}
+		}
+	}
+}
+
+func TestSeqsBreakEarly(t *testing.T) {
+	tree := NewTree[int](WithOrder(3))
+	for val := range 50 {
+		tree.Insert(NewIntRecord(val))
+	}
+
+	keys := make([]int, 0)
+	for record := range tree.Backward() {
+		if record.GetHashableVal() < 45 {
+			break
+		}
+		keys = append(keys, record.GetHashableVal())
+	}
+	if !slices.Equal(keys, []int{49, 48, 47, 46, 45}) {
+		t.Errorf("Expected the loop to stop at 45, got %v", keys)
+	}
+
+	// the tree is not held after breaking out, so it can be written to right away
+	for record := range tree.Range(10, 20) {
+		tree.Delete(record.GetHashableVal())
+		break
+	}
+	if _, err := tree.FindPoint(10); err == nil {
+		t.Errorf("Expected the first record of the range to be deleted")
+	}
+}
+
+func TestSeqsOfEmptyTree(t *testing.T) {
+	tree := NewTree[int]()
+	for _, records := range []iter.Seq[Record[int]]{tree.All(), tree.Range(0, 10), tree.From(0), tree.Backward()} {
+		if found := seqLabels(records); len(found) != 0 {
+			t.Errorf("Expected nothing from an empty tree, got %v", found)
+		}
+	}
+}
+
+func TestSeqsSkipDeletedVersions(t *testing.T) {
+	tree := NewTree[int](WithOrder(3), WithVersions())
+	for val := range 20 {
+		tree.Insert(NewIntRecord(val))
+	}
+	for val := range 20 {
+		if val%3 != 0 {
+			tree.Delete(val)
+		}
+	}
+
+	if found := seqLabels(tree.All()); !slices.Equal(found, []string{"0", "3", "6", "9", "12", "15", "18"}) {
+		t.Errorf("Expected only the keys that are left, got %v", found)
+	}
+	if found := seqLabels(tree.Backward()); !slices.Equal(found, []string{"18", "15", "12", "9", "6", "3", "0"}) {
+		t.Errorf("Expected only the keys that are left, got %v", found)
+	}
+}
+
+func TestSeqsOfStoredTree(t *testing.T) {
+	// a small budget, so that leaves are dropped and read again in between leaves of the scan
+	tree, err := Open[int](filepath.Join(t.TempDir(), "tree.db"), IntRecordCodec{}, WithPageSize(128), WithMemoryBudget(4*128))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+
+	expected := make([]int, 0)
+	for val := range 200 {
+		tree.Insert(NewIntRecord(val))
+		expected = append(expected, val)
+	}
+
+	keys := make([]int, 0)
+	for record := range tree.All() {
+		keys = append(keys, record.GetHashableVal())
+	}
+	if !slices.Equal(keys, expected) {
+		t.Errorf("Expected every key in order, got %v", keys)
+	}
+
+	slices.Reverse(expected)
+	keys = keys[:0]
+	for record := range tree.Backward() {
+		keys = append(keys, record.GetHashableVal())
+	}
+	if !slices.Equal(keys, expected) {
+		t.Errorf("Expected every key in descending order, got %v", keys)
+	}
+}
+
+func TestMapSeqs(t *testing.T) {
+	m := NewMap[int, string](WithOrder(3))
+	for key := range 10 {
+		m.Put(key, fmt.Sprint(key*key))
+	}
+
+	pairs := make([]string, 0)
+	for key, value := range m.Backward() {
+		pairs = append(pairs, fmt.Sprintf("%d:%s", key, value))
+	}
+	if !slices.Equal(pairs, []string{"9:81", "8:64", "7:49", "6:36", "5:25", "4:16", "3:9", "2:4", "1:1", "0:0"}) {
+		t.Errorf("Expected every pair in descending order, got %v", pairs)
+	}
+
+	keys := make([]int, 0)
+	for key := range m.From(7) {
+		keys = append(keys, key)
+	}
+	for key := range m.Range(2, 4).All() {
+		keys = append(keys, key)
+	}
+	for key := range m.All() {
+		if key > 1 {
+			break
+		}
+		keys = append(keys, key)
+	}
+	if !slices.Equal(keys, []int{7, 8, 9, 2, 3, 0, 1}) {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+}
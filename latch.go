@@ -0,0 +1,147 @@
+package bptree
+
+import "cmp"
+
+// how an operation latches the nodes it visits
+type latchMode int
+
+const (
+	// the operation holds the whole tree, so it does not latch anything
+	latchNone latchMode = iota
+	// readers hold a single read latch at a time, latching a child before letting go of its parent
+	latchRead
+	// writers latch nodes for writing, and keep the latches above any node that the write could split or merge
+	latchInsert
+	latchDelete
+	// writers that only ever change the leaf, and can let go of everything above it straight away
+	latchLeaf
+)
+
+// lock the tree for an operation, and return the mode it should latch nodes with
+//
+// operations that latch the nodes they visit share the tree, while the rest need it to themselves
+// trees stored in a file always need it to themselves, since every operation goes through the same buffer pool
+// so do writers while a snapshot is open, since copying a node changes every node above it,
+// writers to a versioned tree, since versions have to be applied in the order they are handed out,
+// writers to a tree that keeps counts or aggregates, since every change to a leaf changes them all the way up to the root,
+// and writers to a tree that validates every change, since the whole tree is checked in the middle of it
+func (t *Tree[T]) lockTree(mode latchMode) (latchMode, func()) {
+	if mode == latchNone || t.store != nil || (mode != latchRead && (t.versioned || t.summarized() || t.validating || t.snapshots.Load() > 0)) {
+		t.mu.Lock()
+		return latchNone, t.mu.Unlock
+	}
+
+	t.mu.RLock()
+	// a snapshot can be taken while waiting for the tree
+	if mode != latchRead && t.snapshots.Load() > 0 {
+		t.mu.RUnlock()
+		return t.lockTree(latchNone)
+	}
+	return mode, t.mu.RUnlock
+}
+
+func latchNode[T cmp.Ordered](n *node[T], mode latchMode) {
+	switch mode {
+	case latchNone:
+	case latchRead:
+		n.latch.RLock()
+	default:
+		n.latch.Lock()
+	}
+}
+
+// latch the node without waiting, for when the latches already held are not in top down order
+func tryLatchNode[T cmp.Ordered](n *node[T], mode latchMode) bool {
+	switch mode {
+	case latchNone:
+		return true
+	case latchRead:
+		return n.latch.TryRLock()
+	default:
+		return n.latch.TryLock()
+	}
+}
+
+func unlatchNode[T cmp.Ordered](n *node[T], mode latchMode) {
+	switch mode {
+	case latchNone:
+	case latchRead:
+		n.latch.RUnlock()
+	default:
+		n.latch.Unlock()
+	}
+}
+
+// whether a change to the node cannot spread to the nodes above it, so their latches can be let go of
+func (t *Tree[T]) safe(n *node[T], isRoot bool, mode latchMode) bool {
+	switch mode {
+	case latchInsert:
+		return n.numKeys < t.maxKeysPerNode
+	case latchDelete:
+		// the root can go below the minimum, but it is replaced by its only child once it runs out of keys
+		if isRoot {
+			return n.isLeaf || n.numKeys > 1
+		}
+		if n.isLeaf {
+			return n.numKeys > t.minLeafKeys
+		}
+		return n.numKeys > t.minNonLeafKeys
+	}
+
+	return true
+}
+
+// the latches that an operation is holding, from the top of the tree down
+type latchPath[T cmp.Ordered] struct {
+	tree *Tree[T]
+	mode latchMode
+
+	// whether the latch on the tree's root pointer is held
+	root  bool
+	nodes []*node[T]
+}
+
+func (p *latchPath[T]) latch(n *node[T]) {
+	latchNode(n, p.mode)
+	p.nodes = append(p.nodes, n)
+}
+
+// let go of every latch above the last node
+func (p *latchPath[T]) releaseAbove() {
+	if p.root {
+		p.unlatchRoot()
+	}
+
+	last := len(p.nodes) - 1
+	for _, n := range p.nodes[:last] {
+		unlatchNode(n, p.mode)
+	}
+	p.nodes = append(p.nodes[:0], p.nodes[last])
+}
+
+// let go of every latch, and hold the one on the node instead
+// this is only for readers, and for walking over the links between leaves
+func (p *latchPath[T]) moveTo(n *node[T]) {
+	p.release()
+	p.nodes = append(p.nodes, n)
+}
+
+func (p *latchPath[T]) release() {
+	if p.root {
+		p.unlatchRoot()
+	}
+
+	for _, n := range p.nodes {
+		unlatchNode(n, p.mode)
+	}
+	p.nodes = p.nodes[:0]
+}
+
+func (p *latchPath[T]) unlatchRoot() {
+	if p.mode == latchRead {
+		p.tree.rootLatch.RUnlock()
+	} else {
+		p.tree.rootLatch.Unlock()
+	}
+	p.root = false
+}
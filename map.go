@@ -0,0 +1,110 @@
+package bptree
+
+import (
+	"cmp"
+	"fmt"
+)
+
+// Map is an ordered key/value map backed by a Tree
+// Values can be of any type, so they do not need to implement Record themselves
+type Map[K cmp.Ordered, V any] struct {
+	tree *Tree[K]
+}
+
+// the record stored in the tree's leaves for every key in a Map
+type mapEntry[K cmp.Ordered, V any] struct {
+	key   K
+	value V
+}
+
+func (e *mapEntry[K, V]) GetHashableVal() K {
+	return e.key
+}
+
+func (e *mapEntry[K, V]) String() string {
+	return fmt.Sprintf("%v:%v", e.key, e.value)
+}
+
+func NewMap[K cmp.Ordered, V any](opts ...TreeOption) *Map[K, V] {
+	return &Map[K, V]{
+		tree: NewTree[K](opts...),
+	}
+}
+
+// Get returns the value stored under key, or ErrNotFound if the key is not in the map
+func (m *Map[K, V]) Get(key K) (V, error) {
+	record, err := m.tree.FindPoint(key)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return record.(*mapEntry[K, V]).value, nil
+}
+
+// Put stores value under key, replacing any value that was already there
+func (m *Map[K, V]) Put(key K, value V) error {
+	_, err := m.tree.Upsert(&mapEntry[K, V]{
+		key:   key,
+		value: value,
+	})
+	return err
+}
+
+// Delete removes key from the map, or returns ErrNotFound if it was not there
+func (m *Map[K, V]) Delete(key K) error {
+	return m.tree.Delete(key)
+}
+
+// DeleteRange removes every pair that satisfies low <= key < high, and returns how many were removed
+func (m *Map[K, V]) DeleteRange(low K, high K) (int, error) {
+	return m.tree.DeleteRange(low, high)
+}
+
+// Range iterates over the pairs that satisfy low <= key < high, in ascending key order
+func (m *Map[K, V]) Range(low K, high K) *MapIterator[K, V] {
+	if m.tree.isEmpty() {
+		return &MapIterator[K, V]{}
+	}
+
+	return &MapIterator[K, V]{
+		records: m.tree.FindRange(low, high),
+	}
+}
+
+// Scan iterates over the pairs with a key in the range, in ascending key order
+func (m *Map[K, V]) Scan(keys KeyRange[K]) *MapIterator[K, V] {
+	if m.tree.isEmpty() {
+		return &MapIterator[K, V]{}
+	}
+
+	return &MapIterator[K, V]{
+		records: m.tree.Scan(keys),
+	}
+}
+
+// MapIterator walks over the key/value pairs of a Map range
+type MapIterator[K cmp.Ordered, V any] struct {
+	// nil when the map was empty
+	records Iterator[K]
+}
+
+// Next returns the next pair, with false once the range is exhausted
+func (it *MapIterator[K, V]) Next() (K, V, bool) {
+	if it.records != nil {
+		if entry, ok := it.records.Next().(*mapEntry[K, V]); ok {
+			return entry.key, entry.value, true
+		}
+	}
+
+	var key K
+	var value V
+	return key, value, false
+}
+
+// Err returns the error that ended the range early, or nil if it ran out of pairs
+func (it *MapIterator[K, V]) Err() error {
+	if it.records == nil {
+		return nil
+	}
+	return it.records.Err()
+}
@@ -0,0 +1,116 @@
+package bptree
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+type mapTestRow struct {
+	Name  string
+	Score int
+}
+
+func TestMapPutAndGet(t *testing.T) {
+	m := NewMap[string, mapTestRow]()
+
+	if _, err := m.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected an empty map to not find anything, got %v", err)
+	}
+
+	m.Put("b", mapTestRow{"b", 1})
+	m.Put("a", mapTestRow{"a", 2})
+	m.Put("c", mapTestRow{"c", 3})
+	m.Put("b", mapTestRow{"b", 4})
+
+	tests := []struct {
+		key      string
+		expected mapTestRow
+		found    bool
+	}{
+		{"a", mapTestRow{"a", 2}, true},
+		{"b", mapTestRow{"b", 4}, true},
+		{"c", mapTestRow{"c", 3}, true},
+		{"d", mapTestRow{}, false},
+	}
+
+	for _, test := range tests {
+		value, err := m.Get(test.key)
+		if found := err == nil; found != test.found || value != test.expected {
+			t.Errorf("Get(%q): expected %+v %v, got %+v %v", test.key, test.expected, test.found, value, err)
+		}
+	}
+}
+
+func TestMapDeleteAndRange(t *testing.T) {
+	m := NewMap[int, string](WithOrder(3))
+
+	if err := m.Delete(1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from delete on an empty map, got %v", err)
+	}
+	if _, _, ok := m.Range(0, 10).Next(); ok {
+		t.Errorf("Expected range on an empty map to be empty")
+	}
+
+	for i := range 10 {
+		m.Put(i, string(rune('a'+i)))
+	}
+
+	if err := m.Delete(4); err != nil {
+		t.Errorf("Expected 4 to be deleted, got %v", err)
+	}
+	if err := m.Delete(4); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected 4 to already be deleted, got %v", err)
+	}
+
+	keys := make([]int, 0)
+	values := make([]string, 0)
+	pairs := m.Range(2, 7)
+	for key, value, ok := pairs.Next(); ok; key, value, ok = pairs.Next() {
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	if !slices.Equal(keys, []int{2, 3, 5, 6}) {
+		t.Errorf("Expected keys [2 3 5 6], got %v", keys)
+	}
+	if !slices.Equal(values, []string{"c", "d", "f", "g"}) {
+		t.Errorf("Expected values [c d f g], got %v", values)
+	}
+}
+
+func TestMapReportsCorruption(t *testing.T) {
+	m := NewMap[int, string](WithOrder(3))
+	for i := range 20 {
+		if err := m.Put(i, fmt.Sprint(i)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	leaf, _ := m.tree.findLeftmostNode(0, latchNone)
+	leaf.pointers[0] = "not a pair"
+
+	if _, err := m.Get(0); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt from Get, got %v", err)
+	}
+	if err := m.Delete(0); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt from Delete, got %v", err)
+	}
+	if err := m.Put(0, "0"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt from Put, got %v", err)
+	}
+
+	// a range is cut out without looking at its records, so the tree is broken somewhere a validating map finds it instead
+	m = NewMap[int, string](WithOrder(3), WithValidation())
+	for i := range 20 {
+		m.Put(i, fmt.Sprint(i))
+	}
+	last, _ := m.tree.findLeftmostNode(19, latchNone)
+	last.prev = nil
+
+	var failure *InvariantError
+	if _, err := m.DeleteRange(0, 5); !errors.As(err, &failure) {
+		t.Errorf("Expected an InvariantError from DeleteRange, got %v", err)
+	}
+}
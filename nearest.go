@@ -0,0 +1,70 @@
+package bptree
+
+// Min returns the record with the smallest key, or ErrEmpty if the tree is empty
+// If duplicates are allowed, the first record with the key is returned
+func (t *Tree[T]) Min(opts ...ReadOption) (Record[T], error) {
+	return t.nearest(opts, (*leafWalk[T]).first)
+}
+
+// Max returns the record with the largest key, or ErrEmpty if the tree is empty
+// If duplicates are allowed, the last record with the key is returned
+func (t *Tree[T]) Max(opts ...ReadOption) (Record[T], error) {
+	return t.nearest(opts, (*leafWalk[T]).last)
+}
+
+// Floor returns the record with the largest key that is not greater than the key, or ErrNotFound if there is none
+// If duplicates are allowed, the last record with that key is returned
+func (t *Tree[T]) Floor(key T, opts ...ReadOption) (Record[T], error) {
+	return t.nearest(opts, func(w *leafWalk[T]) walkResult {
+		return w.floor(key)
+	})
+}
+
+// Ceiling returns the record with the smallest key that is not less than the key, or ErrNotFound if there is none
+// If duplicates are allowed, the first record with that key is returned
+func (t *Tree[T]) Ceiling(key T, opts ...ReadOption) (Record[T], error) {
+	return t.nearest(opts, func(w *leafWalk[T]) walkResult {
+		return w.ceiling(key)
+	})
+}
+
+// Lower returns the record with the largest key that is less than the key, or ErrNotFound if there is none
+// If duplicates are allowed, the last record with that key is returned
+func (t *Tree[T]) Lower(key T, opts ...ReadOption) (Record[T], error) {
+	return t.nearest(opts, func(w *leafWalk[T]) walkResult {
+		return w.lower(key)
+	})
+}
+
+// Higher returns the record with the smallest key that is greater than the key, or ErrNotFound if there is none
+// If duplicates are allowed, the first record with that key is returned
+func (t *Tree[T]) Higher(key T, opts ...ReadOption) (Record[T], error) {
+	return t.nearest(opts, func(w *leafWalk[T]) walkResult {
+		return w.higher(key)
+	})
+}
+
+// descend to a leaf once, and walk from there to the record, across the links between leaves if it is not in that leaf
+func (t *Tree[T]) nearest(opts []ReadOption, walk func(w *leafWalk[T]) walkResult) (record Record[T], err error) {
+	defer t.catchCorrupt(&err)
+
+	asOf, err := t.readVersion(opts)
+	if err != nil {
+		return nil, err
+	}
+	mode, unlock := t.lockTree(latchRead)
+	defer unlock()
+	defer t.release()
+	t.checkVersion(asOf)
+
+	if t.isEmpty() {
+		return nil, ErrEmpty
+	}
+
+	w, result := t.walkTo(asOf, mode, walk)
+	defer w.latches.release()
+	if result != walked {
+		return nil, ErrNotFound
+	}
+	return t.recordAt(w.leaf, w.idx, asOf), nil
+}
@@ -0,0 +1,144 @@
+package bptree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestNearestMatchesModel(t *testing.T) {
+	for _, order := range []int{3, 4, 8} {
+		tree := NewTree[int](WithOrder(order), WithDuplicates())
+		records := make([]*labelledRecord, 0)
+		r := rand.New(rand.NewSource(int64(order)))
+		for i := range 200 {
+			record := &labelledRecord{r.Intn(50) * 2, fmt.Sprint(i)}
+			tree.Insert(record)
+			records = append(records, record)
+		}
+		// deletes make the leaves uneven, so that the answer is often in the next or previous leaf
+		for range 100 {
+			i := r.Intn(len(records))
+			tree.DeleteRecord(records[i])
+			records = slices.Delete(records, i, i+1)
+		}
+		slices.SortStableFunc(records, func(a, b *labelledRecord) int {
+			return a.key - b.key
+		})
+
+		// the first record in tree order that matches, or the last one
+		first := func(match func(key int) bool) string {
+			for _, record := range records {
+				if match(record.key) {
+					return record.label
+				}
+			}
+			return "<nil>"
+		}
+		last := func(match func(key int) bool) string {
+			for i := len(records) - 1; i >= 0; i-- {
+				if match(records[i].key) {
+					return records[i].label
+				}
+			}
+			return "<nil>"
+		}
+		label := func(record Record[int], err error) string {
+			if errors.Is(err, ErrNotFound) {
+				return "<nil>"
+			}
+			if err != nil || record == nil {
+				return fmt.Sprintf("%v and %v", record, err)
+			}
+			return record.String()
+		}
+
+		if found, expected := label(tree.Min()), first(func(int) bool { return true }); found != expected {
+			t.Errorf("Order %d: expected Min to be %s, got %s", order, expected, found)
+		}
+		if found, expected := label(tree.Max()), last(func(int) bool { return true }); found != expected {
+			t.Errorf("Order %d: expected Max to be %s, got %s", order, expected, found)
+		}
+
+		for key := -2; key <= 102; key++ {
+			var tests = []struct {
+				name     string
+				found    string
+				expected string
+			}{
+				{"Floor", label(tree.Floor(key)), last(func(k int) bool { return k <= key })},
+				{"Ceiling", label(tree.Ceiling(key)), first(func(k int) bool { return k >= key })},
+				{"Lower", label(tree.Lower(key)), last(func(k int) bool { return k < key })},
+				{"Higher", label(tree.Higher(key)), first(func(k int) bool { return k > key })},
+			}
+			for _, test := range tests {
+				if test.found != test.expected {
+					t.Errorf("Order %d: expected %s(%d) to be %s, got %s", order, test.name, key, test.expected, test.found)
+				}
+			}
+		}
+	}
+}
+
+func TestNearestOfEmptyTree(t *testing.T) {
+	tree := NewTree[int]()
+	nearest := func() []error {
+		errs := make([]error, 0)
+		for _, find := range []func() (Record[int], error){
+			func() (Record[int], error) { return tree.Min() },
+			func() (Record[int], error) { return tree.Max() },
+			func() (Record[int], error) { return tree.Floor(1) },
+			func() (Record[int], error) { return tree.Ceiling(1) },
+			func() (Record[int], error) { return tree.Lower(1) },
+			func() (Record[int], error) { return tree.Higher(1) },
+		} {
+			record, err := find()
+			if record != nil {
+				t.Errorf("Expected nothing from an empty tree, got %v", record)
+			}
+			errs = append(errs, err)
+		}
+		return errs
+	}
+
+	for _, err := range nearest() {
+		if !errors.Is(err, ErrEmpty) {
+			t.Errorf("Expected ErrEmpty from an empty tree, got %v", err)
+		}
+	}
+
+	tree.Insert(NewIntRecord(1))
+	tree.Delete(1)
+	for _, err := range nearest() {
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound from a tree that had every record deleted, got %v", err)
+		}
+	}
+}
+
+func TestNearestSkipsDeletedVersions(t *testing.T) {
+	tree := NewTree[int](WithOrder(3), WithVersions())
+	for val := range 20 {
+		tree.Insert(NewIntRecord(val))
+	}
+	version := tree.Version()
+	for val := 5; val < 15; val++ {
+		tree.Delete(val)
+	}
+	tree.Delete(0)
+
+	if record, _ := tree.Floor(10); record == nil || record.GetHashableVal() != 4 {
+		t.Errorf("Expected the floor of 10 to be 4, got %v", record)
+	}
+	if record, _ := tree.Higher(4); record == nil || record.GetHashableVal() != 15 {
+		t.Errorf("Expected the key after 4 to be 15, got %v", record)
+	}
+	if record, _ := tree.Min(); record == nil || record.GetHashableVal() != 1 {
+		t.Errorf("Expected the smallest key to be 1, got %v", record)
+	}
+	if record, _ := tree.Floor(10, AsOf(version)); record == nil || record.GetHashableVal() != 10 {
+		t.Errorf("Expected the floor of 10 as of the earlier version to be 10, got %v", record)
+	}
+}
@@ -0,0 +1,112 @@
+package bptree
+
+import "cmp"
+
+// whether a bound includes its key, excludes it, or is not there at all
+type boundKind int
+
+const (
+	// the zero value, so that a KeyRange with a bound left out is open on that end
+	unbounded boundKind = iota
+	inclusive
+	exclusive
+)
+
+// Bound is one end of a KeyRange
+type Bound[T cmp.Ordered] struct {
+	key  T
+	kind boundKind
+}
+
+// Inclusive is a bound that includes the key itself
+func Inclusive[T cmp.Ordered](key T) Bound[T] {
+	return Bound[T]{key: key, kind: inclusive}
+}
+
+// Exclusive is a bound that stops just short of the key
+func Exclusive[T cmp.Ordered](key T) Bound[T] {
+	return Bound[T]{key: key, kind: exclusive}
+}
+
+// Unbounded leaves an end of the range open, which is the same as leaving the bound out
+func Unbounded[T cmp.Ordered]() Bound[T] {
+	return Bound[T]{}
+}
+
+// KeyRange is the keys between a lower and an upper bound
+// Either bound can be left out, so KeyRange[T]{Low: Inclusive(5)} is every key from 5 up, and KeyRange[T]{} is every key
+type KeyRange[T cmp.Ordered] struct {
+	Low  Bound[T]
+	High Bound[T]
+}
+
+// Contains returns whether the key is in the range
+func (r KeyRange[T]) Contains(key T) bool {
+	return !r.below(key) && !r.above(key)
+}
+
+// whether the key comes before the lower bound
+func (r KeyRange[T]) below(key T) bool {
+	switch r.Low.kind {
+	case inclusive:
+		return key < r.Low.key
+	case exclusive:
+		return key <= r.Low.key
+	}
+	return false
+}
+
+// whether the key comes after the upper bound
+func (r KeyRange[T]) above(key T) bool {
+	switch r.High.kind {
+	case inclusive:
+		return key > r.High.key
+	case exclusive:
+		return key >= r.High.key
+	}
+	return false
+}
+
+// whether every key in the other range is in the range, for another range with inclusive bounds
+func (r KeyRange[T]) covers(other KeyRange[T]) bool {
+	coversLow := r.Low.kind == unbounded || (other.Low.kind != unbounded && !r.below(other.Low.key))
+	coversHigh := r.High.kind == unbounded || (other.High.kind != unbounded && !r.above(other.High.key))
+	return coversLow && coversHigh
+}
+
+// whether no key in the other range is in the range, for another range with inclusive bounds
+func (r KeyRange[T]) misses(other KeyRange[T]) bool {
+	return (other.High.kind != unbounded && r.below(other.High.key)) || (other.Low.kind != unbounded && r.above(other.Low.key))
+}
+
+// the range low <= x < high that FindRange takes
+func halfOpen[T cmp.Ordered](low T, high T) KeyRange[T] {
+	return KeyRange[T]{
+		Low:  Inclusive(low),
+		High: Exclusive(high),
+	}
+}
+
+// Scan iterates over the records with a key in the range, in ascending key order
+func (t *Tree[T]) Scan(keys KeyRange[T], opts ...ReadOption) Iterator[T] {
+	return t.scan(keys, opts, false)
+}
+
+// ScanReverse iterates over the records with a key in the range, in descending key order
+func (t *Tree[T]) ScanReverse(keys KeyRange[T], opts ...ReadOption) Iterator[T] {
+	return t.scan(keys, opts, true)
+}
+
+// start an iterator over the range for a read with the options, which has already failed if the tree cannot be read as they ask
+func (t *Tree[T]) scan(keys KeyRange[T], opts []ReadOption, reverse bool) Iterator[T] {
+	asOf, err := t.readVersion(opts)
+	if err != nil {
+		return &rangeIterator[T]{err: err}
+	}
+
+	_, unlock := t.lockTree(latchRead)
+	defer unlock()
+	defer t.release()
+
+	return t.newRangeIterator(keys, asOf, reverse)
+}
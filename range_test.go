@@ -0,0 +1,84 @@
+package bptree
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestScanBounds(t *testing.T) {
+	tree := NewTree[int](WithOrder(3), WithDuplicates())
+	model := make([]int, 0)
+	r := rand.New(rand.NewSource(1))
+	for range 300 {
+		val := r.Intn(60)
+		tree.Insert(NewIntRecord(val))
+		model = append(model, val)
+	}
+	slices.Sort(model)
+
+	bounds := func(key int) []Bound[int] {
+		return []Bound[int]{Inclusive(key), Exclusive(key), Unbounded[int]()}
+	}
+	for range 50 {
+		low, high := r.Intn(70)-5, r.Intn(70)-5
+		for _, lowBound := range bounds(low) {
+			for _, highBound := range bounds(high) {
+				keys := KeyRange[int]{Low: lowBound, High: highBound}
+
+				expected := make([]int, 0)
+				for _, val := range model {
+					if keys.Contains(val) {
+						expected = append(expected, val)
+					}
+				}
+				if found := collectKeys(tree.Scan(keys)); !slices.Equal(found, expected) {
+					t.Errorf("Scan of %+v:\nExpected: %v\nGot: %v", keys, expected, found)
+				}
+
+				slices.Reverse(expected)
+				if found := collectKeys(tree.ScanReverse(keys)); !slices.Equal(found, expected) {
+					t.Errorf("Reverse scan of %+v:\nExpected: %v\nGot: %v", keys, expected, found)
+				}
+			}
+		}
+	}
+}
+
+func TestScanContains(t *testing.T) {
+	var tests = []struct {
+		keys     KeyRange[int]
+		contains []bool
+	}{
+		{KeyRange[int]{}, []bool{true, true, true, true, true}},
+		{KeyRange[int]{Low: Inclusive(1), High: Inclusive(3)}, []bool{false, true, true, true, false}},
+		{KeyRange[int]{Low: Exclusive(1), High: Exclusive(3)}, []bool{false, false, true, false, false}},
+		{KeyRange[int]{Low: Exclusive(1)}, []bool{false, false, true, true, true}},
+		{KeyRange[int]{High: Inclusive(1)}, []bool{true, true, false, false, false}},
+		{KeyRange[int]{Low: Exclusive(2), High: Exclusive(2)}, []bool{false, false, false, false, false}},
+	}
+
+	for _, test := range tests {
+		for key, expected := range test.contains {
+			if test.keys.Contains(key) != expected {
+				t.Errorf("Expected %+v to contain %d: %v", test.keys, key, expected)
+			}
+		}
+	}
+}
+
+func TestScanOpenEndedStrings(t *testing.T) {
+	m := NewMap[string, int]()
+	for i, name := range []string{"ada", "bob", "cy", "dee", "eve"} {
+		m.Put(name, i)
+	}
+
+	found := make([]string, 0)
+	for key, value := range m.Scan(KeyRange[string]{Low: Exclusive("bob")}).All() {
+		found = append(found, fmt.Sprintf("%s:%d", key, value))
+	}
+	if !slices.Equal(found, []string{"cy:2", "dee:3", "eve:4"}) {
+		t.Errorf("Expected every key after bob, got %v", found)
+	}
+}
@@ -0,0 +1,245 @@
+package bptree
+
+import (
+	"cmp"
+	"sync/atomic"
+)
+
+// Snapshot is a read only view of a tree as it was when the snapshot was taken
+//
+// It shares its nodes with the tree, and writers copy a node before they change it, along with the path above it,
+// so a snapshot never sees a change and can be read while writers carry on
+// Scans of a snapshot do not use the links between leaves, which are the one part of a shared node that writers still change
+type Snapshot[T cmp.Ordered] struct {
+	tree   *Tree[T]
+	root   *node[T]
+	closed atomic.Bool
+}
+
+// Snapshot returns a view of the tree as it is now, which later changes to the tree do not show up in
+// Close the snapshot once you are done with it and every iterator from it, since until then writers have to copy the nodes they change,
+// and take the whole tree to themselves while they do
+// Only trees that live in memory can be snapshotted
+func (t *Tree[T]) Snapshot() *Snapshot[T] {
+	if t.store != nil {
+		panic("Trees stored in a file cannot be snapshotted")
+	}
+
+	_, unlock := t.lockTree(latchNone)
+	defer unlock()
+
+	// every node there is now belongs to the snapshot as well
+	t.generation++
+	t.snapshots.Add(1)
+
+	return &Snapshot[T]{
+		tree: t,
+		root: t.root,
+	}
+}
+
+// Close lets the tree change its nodes in place again, once every snapshot is closed
+// The snapshot and the iterators from it cannot be used after it is closed
+func (s *Snapshot[T]) Close() {
+	if s.closed.CompareAndSwap(false, true) {
+		s.tree.snapshots.Add(-1)
+	}
+}
+
+// FindPoint returns the record stored under the key when the snapshot was taken, or nil if there was none
+// If duplicates are allowed, the first record with the key is returned
+func (s *Snapshot[T]) FindPoint(val T) Record[T] {
+	return s.newIterator(val, func(key T) bool {
+		return key > val
+	}).Next()
+}
+
+// FindRange iterates over the records that satisfied low <= x < high when the snapshot was taken
+func (s *Snapshot[T]) FindRange(low T, high T) Iterator[T] {
+	return s.newIterator(low, func(key T) bool {
+		return key >= high
+	})
+}
+
+// FindAll iterates over every record that was stored under the key when the snapshot was taken
+func (s *Snapshot[T]) FindAll(val T) Iterator[T] {
+	return s.newIterator(val, func(key T) bool {
+		return key > val
+	})
+}
+
+// walks the snapshot's leaves in order by going back up the path to them, since the links between leaves belong to the live tree
+type snapshotIterator[T cmp.Ordered] struct {
+	snapshot *Snapshot[T]
+
+	// the nodes from the root down to the current leaf, and the index of the pointer followed in each
+	// for the leaf, the index is the next record
+	path    []*node[T]
+	indices []int
+
+	pastEnd func(key T) bool
+	// the failure that ended the iteration early
+	err error
+}
+
+// start an iterator at the first key that is not less than start
+func (s *Snapshot[T]) newIterator(start T, pastEnd func(key T) bool) *snapshotIterator[T] {
+	s.checkOpen()
+
+	n := &snapshotIterator[T]{
+		snapshot: s,
+		pastEnd:  pastEnd,
+	}
+	if s.root == nil {
+		return n
+	}
+
+	// a run of equal keys can start to the left of the separator with the same key
+	current := s.root
+	for !current.isLeaf {
+		ptrIdx := current.numKeys
+		for i, key := range current.keys[:current.numKeys] {
+			if start <= key {
+				ptrIdx = i
+				break
+			}
+		}
+
+		n.path = append(n.path, current)
+		n.indices = append(n.indices, ptrIdx)
+		current = current.pointers[ptrIdx].(*node[T])
+	}
+
+	idx := current.numKeys
+	for i, key := range current.keys[:current.numKeys] {
+		if key >= start {
+			idx = i
+			break
+		}
+	}
+
+	n.path = append(n.path, current)
+	n.indices = append(n.indices, idx)
+	return n
+}
+
+func (n *snapshotIterator[T]) Next() Record[T] {
+	n.snapshot.checkOpen()
+	if n.err != nil {
+		return nil
+	}
+	defer n.snapshot.tree.catchCorrupt(&n.err)
+
+	for len(n.path) > 0 {
+		last := len(n.path) - 1
+		leaf, idx := n.path[last], n.indices[last]
+
+		if idx == leaf.numKeys {
+			n.nextLeaf()
+			continue
+		}
+
+		if n.pastEnd(leaf.keys[idx]) {
+			n.path = nil
+			return nil
+		}
+
+		n.indices[last]++
+		if record := n.snapshot.tree.recordAt(leaf, idx, latestVersion); record != nil {
+			return record
+		}
+	}
+
+	return nil
+}
+
+func (n *snapshotIterator[T]) Err() error {
+	return n.err
+}
+
+// move to the start of the leaf after the current one, going up until there is a pointer to the right to follow
+func (n *snapshotIterator[T]) nextLeaf() {
+	n.path, n.indices = n.path[:len(n.path)-1], n.indices[:len(n.indices)-1]
+
+	for len(n.path) > 0 {
+		last := len(n.path) - 1
+		parent := n.path[last]
+		if n.indices[last] == parent.numKeys {
+			n.path, n.indices = n.path[:last], n.indices[:last]
+			continue
+		}
+
+		n.indices[last]++
+		child := parent.pointers[n.indices[last]].(*node[T])
+		for {
+			n.path = append(n.path, child)
+			n.indices = append(n.indices, 0)
+			if child.isLeaf {
+				return
+			}
+			child = child.pointers[0].(*node[T])
+		}
+	}
+}
+
+func (s *Snapshot[T]) checkOpen() {
+	if s.closed.Load() {
+		panic("Snapshot is closed")
+	}
+}
+
+// whether the node belongs to an open snapshot as well as the tree, so that it cannot be changed in place
+func (t *Tree[T]) shared(n *node[T]) bool {
+	return t.snapshots.Load() > 0 && n.generation < t.generation
+}
+
+// return a copy of the node that only the tree holds, which it is safe to change, in place of the node in the tree
+// the nodes above it are copied first, since they have to point to the copy
+// this needs the whole tree, and the node's parent and the links between leaves have to be up to date
+func (t *Tree[T]) unshare(n *node[T]) *node[T] {
+	if !t.shared(n) {
+		return n
+	}
+
+	// copying the parent points the node at the copy as well
+	parent := n.parent
+	if parent != nil {
+		parent = t.unshare(parent)
+	}
+
+	c := t.newNode()
+	c.isLeaf = n.isLeaf
+	copy(c.keys, n.keys)
+	copy(c.pointers, n.pointers)
+	c.numKeys = n.numKeys
+	c.count = n.count
+	c.summary = n.summary
+	c.parent = parent
+
+	if parent == nil {
+		t.root = c
+	} else {
+		idx := t.getNodeIndexInParent(n, parent)
+		if idx == -1 {
+			corrupt(n, "could not find node idx")
+		}
+		parent.pointers[idx] = c
+	}
+
+	// the parents of the children and the links between leaves are only read by the tree, so they can change in shared nodes
+	if c.isLeaf {
+		c.prev = n.prev
+		if c.prev != nil {
+			c.prev.pointers[t.maxLeafPointers] = c
+		}
+		t.linkBack(c)
+	} else {
+		for _, ptr := range c.pointers[:c.numKeys+1] {
+			ptr.(*node[T]).parent = c
+		}
+	}
+
+	// scans of the tree that were in the node have to find their place again
+	n.version++
+	return c
+}
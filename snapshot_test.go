@@ -0,0 +1,170 @@
+package bptree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotIsUnchangedByWrites(t *testing.T) {
+	for _, order := range []int{3, 4, 7} {
+		for _, allowDuplicates := range []bool{false, true} {
+			t.Run(fmt.Sprintf("order %d, duplicates %v", order, allowDuplicates), func(t *testing.T) {
+				opts := []TreeOption{WithOrder(order)}
+				if allowDuplicates {
+					opts = append(opts, WithDuplicates())
+				}
+				tree := NewTree[int](opts...)
+				r := rand.New(rand.NewSource(int64(order)))
+
+				// each snapshot, along with what the tree held when it was taken
+				snapshots := make([]*Snapshot[int], 0)
+				expected := make([][]int, 0)
+				live := make([]int, 0)
+
+				for step := range 3000 {
+					if step%500 == 0 {
+						snapshots = append(snapshots, tree.Snapshot())
+						expected = append(expected, slices.Clone(live))
+					}
+					// closing one of them lets the nodes it held change in place again
+					if step == 1700 {
+						snapshots[1].Close()
+					}
+
+					val := r.Intn(300)
+					if r.Intn(5) < 3 {
+						if tree.Insert(NewIntRecord(val)) == nil {
+							live = append(live, val)
+						}
+					} else if tree.Delete(val) == nil {
+						live = slices.Delete(live, slices.Index(live, val), slices.Index(live, val)+1)
+					}
+				}
+
+				slices.Sort(live)
+				if keys := collectKeys(tree.FindRange(-1, 300)); !slices.Equal(keys, live) {
+					t.Errorf("Live tree did not match:\nExpected: %v\nGot: %v", live, keys)
+				}
+				checkParents(t, tree.root)
+				checkLeafLinks(t, tree)
+
+				for i, snapshot := range snapshots {
+					if i == 1 {
+						continue
+					}
+
+					want := slices.Clone(expected[i])
+					slices.Sort(want)
+					if keys := collectKeys(snapshot.FindRange(-1, 300)); !slices.Equal(keys, want) {
+						t.Errorf("Snapshot %d did not match:\nExpected: %v\nGot: %v", i, want, keys)
+					}
+					if keys := collectKeys(snapshot.FindRange(100, 200)); !slices.Equal(keys, filterRange(want, 100, 200)) {
+						t.Errorf("Range of snapshot %d did not match:\nExpected: %v\nGot: %v", i, filterRange(want, 100, 200), keys)
+					}
+					for val := range 300 {
+						if found := snapshot.FindPoint(val) != nil; found != slices.Contains(want, val) {
+							t.Errorf("FindPoint of %d on snapshot %d returned %v", val, i, found)
+						}
+					}
+					snapshot.Close()
+				}
+			})
+		}
+	}
+}
+
+func TestSnapshotOfDuplicates(t *testing.T) {
+	tree := NewTree[int](WithOrder(3), WithDuplicates())
+	for i := range 10 {
+		tree.Insert(&labelledRecord{5, fmt.Sprint(i)})
+	}
+
+	snapshot := tree.Snapshot()
+	defer snapshot.Close()
+	for range 10 {
+		tree.Delete(5)
+	}
+
+	if labels := collectLabels(snapshot.FindAll(5)); !slices.Equal(labels, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}) {
+		t.Errorf("Expected every record from before the deletes, got %v", labels)
+	}
+	if _, err := tree.FindPoint(5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the live tree to be empty, got %v", err)
+	}
+}
+
+func TestSnapshotOfEmptyTree(t *testing.T) {
+	tree := NewTree[int]()
+	snapshot := tree.Snapshot()
+	defer snapshot.Close()
+
+	tree.Insert(NewIntRecord(1))
+	if snapshot.FindPoint(1) != nil {
+		t.Errorf("Expected nothing in the snapshot")
+	}
+	if keys := collectKeys(snapshot.FindRange(0, 10)); len(keys) != 0 {
+		t.Errorf("Expected an empty range, got %v", keys)
+	}
+}
+
+func TestSnapshotPanicsOnceClosed(t *testing.T) {
+	tree := NewTree[int]()
+	tree.Insert(NewIntRecord(1))
+	snapshot := tree.Snapshot()
+	snapshot.Close()
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic")
+		}
+	}()
+	snapshot.FindPoint(1)
+}
+
+func TestSnapshotScanWhileWriting(t *testing.T) {
+	tree := NewTree[int](WithOrder(4))
+	expected := make([]int, 0)
+	for val := 0; val < 1000; val += 2 {
+		tree.Insert(NewIntRecord(val))
+		expected = append(expected, val)
+	}
+
+	snapshot := tree.Snapshot()
+	defer snapshot.Close()
+
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			for range 2000 {
+				if val := r.Intn(1000); r.Intn(2) == 0 {
+					tree.Insert(NewIntRecord(val))
+				} else {
+					tree.Delete(val)
+				}
+			}
+		}()
+	}
+
+	for r := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if keys := collectKeys(snapshot.FindRange(0, 1000)); !slices.Equal(keys, expected) {
+					t.Errorf("Reader %d saw the snapshot change:\nExpected: %v\nGot: %v", r, expected, keys)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	checkParents(t, tree.root)
+}
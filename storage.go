@@ -0,0 +1,947 @@
+package bptree
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+)
+
+const (
+	DEFAULT_PAGE_SIZE = 4096
+
+	// the first page of the file describes the tree, every other page holds a node or is free
+	META_PAGE_ID = 0
+
+	// checksum and page type, at the start of every page
+	PAGE_HEADER_SIZE = 5
+
+	// smallest page that the meta page always fits in
+	MIN_PAGE_SIZE = 128
+)
+
+const (
+	pageTypeMeta byte = iota + 1
+	pageTypeLeaf
+	pageTypeNonLeaf
+	pageTypeFree
+)
+
+var (
+	// ErrCorruptPage is returned when a page of the tree's file or its log cannot be read back, and matches ErrCorrupt as well
+	ErrCorruptPage error = corruptPageError{}
+	ErrPageFull          = errors.New("bptree: node does not fit in a page")
+	ErrClosed            = errors.New("bptree: tree is closed")
+)
+
+type corruptPageError struct{}
+
+func (corruptPageError) Error() string {
+	return "bptree: page is corrupt"
+}
+
+func (corruptPageError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// the magic bytes at the start of the meta page
+var pageFileMagic = []byte("BPTREE01")
+
+// Codec converts keys and records to and from bytes, so that a tree can be written to disk
+type Codec[T cmp.Ordered] interface {
+	EncodeKey(key T) ([]byte, error)
+	DecodeKey(data []byte) (T, error)
+
+	EncodeRecord(record Record[T]) ([]byte, error)
+	DecodeRecord(data []byte) (Record[T], error)
+}
+
+// IntRecordCodec stores the NumRecords made with NewIntRecord
+type IntRecordCodec struct{}
+
+func (IntRecordCodec) EncodeKey(key int) ([]byte, error) {
+	return binary.AppendVarint(nil, int64(key)), nil
+}
+
+func (IntRecordCodec) DecodeKey(data []byte) (int, error) {
+	val, n := binary.Varint(data)
+	if n <= 0 {
+		return 0, fmt.Errorf("%w: bad int key", ErrCorruptPage)
+	}
+	return int(val), nil
+}
+
+func (c IntRecordCodec) EncodeRecord(record Record[int]) ([]byte, error) {
+	return c.EncodeKey(record.GetHashableVal())
+}
+
+func (c IntRecordCodec) DecodeRecord(data []byte) (Record[int], error) {
+	val, err := c.DecodeKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewIntRecord(val), nil
+}
+
+// keeps track of a tree's pages in its file
+type pageStore[T cmp.Ordered] struct {
+	file     File
+	codec    Codec[T]
+	pageSize int
+
+	// number of pages in the file, including the meta page and free pages
+	pageCount uint64
+	// pages that were freed by merges, and can be handed out again
+	// they are used as a stack, so the last page is the next one to be handed out
+	free []uint64
+	// free pages that have not been written out as part of the free list yet, with the page they link to
+	freePending map[uint64]uint64
+
+	// the resident nodes, by page id
+	nodes map[uint64]*node[T]
+	// the nodes whose keys and pointers are in memory
+	pool bufferPool[T]
+
+	// nodes that have changed since they were last written
+	dirty map[*node[T]]struct{}
+	// the meta page is written along with any other change, so this is only needed for a new file
+	metaDirty bool
+
+	// only set for trees opened with WithWAL
+	wal            *writeAheadLog
+	checkpointSize int64
+	// the latest image of every page that is in the log but not yet in the file
+	unwritten map[uint64][]byte
+
+	// set once a change could not be made durable, after which the tree refuses any more changes
+	err error
+}
+
+// WithPageSize sets the size of the pages that a tree opened with Open is stored in
+// It only applies when the file is created, since existing files keep the page size they were made with
+// A page has to fit a full node of the tree's order, and a record that would leave a node too large for a page is turned away with ErrPageFull
+func WithPageSize(pageSize int) TreeOption {
+	return func(o *treeOptions) {
+		o.pageSize = pageSize
+	}
+}
+
+// Open loads the tree stored in the file at path, or creates an empty one if the file does not exist yet
+//
+// Each node is stored in a fixed size page, and child and next leaf links are stored as page ids
+// Only the root is read when the tree is opened, and every other node is read as it is needed,
+// with the nodes kept in memory bounded by WithMemoryBudget
+// Changes are written to the file by Sync or Close, or earlier when a changed node is evicted to stay within the budget
+// Without WithWAL, a crash before the next sync can leave the file half written
+// The order and duplicate mode of an existing file take precedence over the options
+// Trees with versions, counts or aggregates cannot be stored in a file
+func Open[T cmp.Ordered](path string, codec Codec[T], opts ...TreeOption) (*Tree[T], error) {
+	options := buildTreeOptions(opts)
+	if options.versioned {
+		return nil, errors.New("bptree: versioned trees cannot be stored in a file")
+	}
+	if options.counted || options.aggregate != nil {
+		return nil, errors.New("bptree: trees with counts or aggregates cannot be stored in a file")
+	}
+
+	file, err := options.fs.OpenFile(path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// if a log was left behind, whatever made it into it has to be recovered before the file can be read
+	// the log is only created for trees that use it
+	walFile, err := options.fs.OpenFile(walPath(path), options.wal)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		file.Close()
+		return nil, err
+	}
+
+	var wal *writeAheadLog
+	if walFile != nil {
+		wal = &writeAheadLog{file: walFile}
+		if err := wal.replay(file); err != nil {
+			file.Close()
+			walFile.Close()
+			return nil, err
+		}
+
+		if !options.wal {
+			walFile.Close()
+			wal = nil
+		}
+	}
+
+	t, err := openPageFile(file, wal, codec, options)
+	if err != nil {
+		file.Close()
+		if wal != nil {
+			wal.file.Close()
+		}
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func openPageFile[T cmp.Ordered](file File, wal *writeAheadLog, codec Codec[T], options treeOptions) (*Tree[T], error) {
+	size, err := file.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	store := &pageStore[T]{
+		file:        file,
+		codec:       codec,
+		freePending: make(map[uint64]uint64),
+		nodes:       make(map[uint64]*node[T]),
+		dirty:       make(map[*node[T]]struct{}),
+
+		wal:            wal,
+		checkpointSize: options.checkpointSize,
+		unwritten:      make(map[uint64][]byte),
+	}
+
+	// a new file starts off with just the meta page of an empty tree
+	if size == 0 {
+		if options.pageSize < MIN_PAGE_SIZE {
+			return nil, fmt.Errorf("bptree: page size must be at least %d, got %d", MIN_PAGE_SIZE, options.pageSize)
+		}
+
+		t := newTree[T](options)
+		store.pageSize = options.pageSize
+		if err := store.checkOrder(t); err != nil {
+			return nil, err
+		}
+		store.pageCount = 1
+		store.pool = newBufferPool[T](options.memoryBudget, store.pageSize)
+		store.metaDirty = true
+		t.store = store
+
+		// with a log, the meta page goes through it like any other change
+		if err := t.commit(); err != nil {
+			return nil, err
+		}
+		if err := t.Sync(); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+
+	meta, err := readMetaPage(file)
+	if err != nil {
+		return nil, err
+	}
+
+	options.order = meta.order
+	options.allowDuplicates = meta.allowDuplicates
+	t := newTree[T](options)
+
+	store.pageSize = meta.pageSize
+	store.pageCount = meta.pageCount
+	store.pool = newBufferPool[T](options.memoryBudget, store.pageSize)
+	t.store = store
+
+	if meta.rootPageID != 0 {
+		height, err := store.height(meta.rootPageID)
+		if err != nil {
+			return nil, err
+		}
+		if t.root, err = store.load(t, meta.rootPageID, height); err != nil {
+			return nil, err
+		}
+	}
+
+	if store.free, err = store.loadFreeList(meta.freePageID); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Sync writes every change made since the tree was opened or last synced to its file
+// With WithWAL, changes are already durable, so this writes the log into the file and empties it
+// Trees that are not stored in a file have nothing to sync
+func (t *Tree[T]) Sync() error {
+	if t.store == nil {
+		return nil
+	}
+
+	_, unlock := t.lockTree(latchNone)
+	defer unlock()
+
+	return t.sync()
+}
+
+func (t *Tree[T]) sync() error {
+	s := t.store
+	if s.file == nil {
+		return ErrClosed
+	}
+	if s.err != nil {
+		return s.err
+	}
+
+	if s.wal != nil {
+		if err := s.checkpoint(); err != nil {
+			s.err = err
+			return err
+		}
+		return nil
+	}
+
+	images, err := s.collectChanges(t)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		if _, err := s.file.WriteAt(image.data, int64(image.pageID)*int64(s.pageSize)); err != nil {
+			return err
+		}
+	}
+	return s.file.Sync()
+}
+
+// Close syncs the tree to its file and closes it
+// The tree cannot be used once it is closed, and reads return ErrClosed just as changes do
+func (t *Tree[T]) Close() error {
+	s := t.store
+	if s == nil {
+		return nil
+	}
+
+	_, unlock := t.lockTree(latchNone)
+	defer unlock()
+
+	if s.file == nil {
+		return ErrClosed
+	}
+
+	err := t.sync()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	if s.wal != nil {
+		if closeErr := s.wal.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	s.file = nil
+	return err
+}
+
+// Err returns the error that stopped the tree from taking any more changes, if there was one
+// Once a change fails to be logged, it is in memory but not durable, and once a node fails to be read from the file,
+// the tree is missing part of itself, so either way it has to be reopened to recover
+//
+// Otherwise, it returns the error that ended the latest loop over All, Range, From or Backward early,
+// such as a CorruptError for a broken tree, or nil if that loop ran to its end or was broken out of
+// A loop in another goroutine can end in between, so check it straight after the loop
+func (t *Tree[T]) Err() error {
+	if t.store != nil {
+		_, unlock := t.lockTree(latchNone)
+		defer unlock()
+
+		if t.store.err != nil {
+			return t.store.err
+		}
+	}
+
+	if err := t.loopErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// whether the tree can take changes, which it cannot once it is closed or has failed to log a change
+func (t *Tree[T]) writable() bool {
+	return t.store == nil || (t.store.file != nil && t.store.err == nil)
+}
+
+// record that the node changed, so that scans can tell, and that it has to be written out on the next sync
+func (t *Tree[T]) markDirty(nodes ...*node[T]) {
+	for _, n := range nodes {
+		n.version++
+		if t.store != nil {
+			t.store.dirty[n] = struct{}{}
+		}
+	}
+}
+
+// give a node that is no longer part of the tree's page back to the store
+func (t *Tree[T]) freeNode(n *node[T]) {
+	// scans that were in the node have to find their place again
+	n.version++
+
+	s := t.store
+	if s == nil {
+		return
+	}
+
+	// the free pages form a linked list, starting from the meta page
+	// each page links to the page that was on top of the stack before it
+	var next uint64
+	if len(s.free) > 0 {
+		next = s.free[len(s.free)-1]
+	}
+
+	delete(s.dirty, n)
+	s.forget(n)
+	s.free = append(s.free, n.pageID)
+	s.freePending[n.pageID] = next
+}
+
+// hand out a page for a new node, reusing a free page if there is one
+func (s *pageStore[T]) allocate() uint64 {
+	if len(s.free) > 0 {
+		pageID := s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+		delete(s.freePending, pageID)
+		return pageID
+	}
+
+	s.pageCount++
+	return s.pageCount - 1
+}
+
+// encode every page that changed since the last time, including the meta page
+// nothing is cleared unless every page could be encoded
+func (s *pageStore[T]) collectChanges(t *Tree[T]) ([]pageImage, error) {
+	images := make([]pageImage, 0, len(s.dirty)+len(s.freePending)+1)
+
+	for n := range s.dirty {
+		page, err := s.encodeNode(t, n)
+		if err != nil {
+			return nil, err
+		}
+		if images, err = s.appendImage(images, n.pageID, page); err != nil {
+			return nil, err
+		}
+	}
+
+	for pageID, next := range s.freePending {
+		page := s.newPage(pageTypeFree)
+		page = binary.AppendUvarint(page, next)
+
+		var err error
+		if images, err = s.appendImage(images, pageID, page); err != nil {
+			return nil, err
+		}
+	}
+
+	images, err := s.appendImage(images, META_PAGE_ID, s.encodeMeta(t))
+	if err != nil {
+		return nil, err
+	}
+
+	clear(s.dirty)
+	clear(s.freePending)
+	s.metaDirty = false
+	return images, nil
+}
+
+func (s *pageStore[T]) newPage(pageType byte) []byte {
+	page := make([]byte, PAGE_HEADER_SIZE, s.pageSize)
+	page[4] = pageType
+	return page
+}
+
+// pad the page out to the page size and checksum it, so that it is ready to be written
+func (s *pageStore[T]) appendImage(images []pageImage, pageID uint64, page []byte) ([]pageImage, error) {
+	if len(page) > s.pageSize {
+		return nil, fmt.Errorf("%w: page %d needs %d bytes, but pages are %d bytes", ErrPageFull, pageID, len(page), s.pageSize)
+	}
+
+	// the page was allocated with the page size as its capacity, so the padding is already zeroed
+	page = page[:s.pageSize]
+	binary.LittleEndian.PutUint32(page, crc32.ChecksumIEEE(page[4:]))
+
+	return append(images, pageImage{pageID: pageID, data: page}), nil
+}
+
+// read a page and check that it has not been torn or corrupted since it was written
+func (s *pageStore[T]) readPage(pageID uint64, pageTypes ...byte) (*pageReader, error) {
+	// with a log, the latest image of the page may not have made it into the file yet
+	if page, ok := s.unwritten[pageID]; ok {
+		return checkPage(pageID, page, pageTypes...)
+	}
+
+	page := make([]byte, s.pageSize)
+	if _, err := s.file.ReadAt(page, int64(pageID)*int64(s.pageSize)); err != nil {
+		return nil, fmt.Errorf("bptree: reading page %d: %w", pageID, err)
+	}
+
+	return checkPage(pageID, page, pageTypes...)
+}
+
+func checkPage(pageID uint64, page []byte, pageTypes ...byte) (*pageReader, error) {
+	if binary.LittleEndian.Uint32(page) != crc32.ChecksumIEEE(page[4:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch on page %d", ErrCorruptPage, pageID)
+	}
+
+	for _, pageType := range pageTypes {
+		if page[4] == pageType {
+			return &pageReader{page: page, offset: PAGE_HEADER_SIZE}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: page %d has unexpected type %d", ErrCorruptPage, pageID, page[4])
+}
+
+// a page is laid out as
+//
+//	checksum (4 bytes) | page type (1 byte) | number of keys | [next leaf page id] | entries
+//
+// where the entries of a leaf are key and record pairs, and the entries of a nonleaf are the keys followed by the child page ids
+// numbers are stored as uvarints, and keys and records are prefixed with their length
+func (s *pageStore[T]) encodeNode(t *Tree[T], n *node[T]) ([]byte, error) {
+	pageType := pageTypeNonLeaf
+	if n.isLeaf {
+		pageType = pageTypeLeaf
+	}
+
+	page := s.newPage(pageType)
+	page = binary.AppendUvarint(page, uint64(n.numKeys))
+
+	if n.isLeaf {
+		next, _ := n.pointers[t.maxLeafPointers].(pageLink)
+		page = binary.AppendUvarint(page, uint64(next))
+
+		for i := range n.numKeys {
+			key, err := s.codec.EncodeKey(n.keys[i])
+			if err != nil {
+				return nil, err
+			}
+			record, err := s.codec.EncodeRecord(n.pointers[i].(Record[T]))
+			if err != nil {
+				return nil, err
+			}
+
+			page = appendBytes(page, key)
+			page = appendBytes(page, record)
+		}
+
+		return page, nil
+	}
+
+	for i := range n.numKeys {
+		key, err := s.codec.EncodeKey(n.keys[i])
+		if err != nil {
+			return nil, err
+		}
+		page = appendBytes(page, key)
+	}
+	for i := range n.numKeys + 1 {
+		page = binary.AppendUvarint(page, uint64(n.pointers[i].(pageLink)))
+	}
+
+	return page, nil
+}
+
+// check that a full node of the tree's order fits in a page, even with the smallest keys and records,
+// which are taken to be the encoding of the zero key and an empty record
+// otherwise the tree would turn away records once its nodes fill up, however small they are
+func (s *pageStore[T]) checkOrder(t *Tree[T]) error {
+	var zero T
+	keySize, err := s.keySize(zero)
+	if err != nil {
+		return err
+	}
+
+	maxKeys := t.maxKeysPerNode
+	leafSize := PAGE_HEADER_SIZE + uvarintLen(uint64(maxKeys)) + uvarintLen(0) + maxKeys*(keySize+uvarintLen(0))
+	nonLeafSize := PAGE_HEADER_SIZE + uvarintLen(uint64(maxKeys)) + maxKeys*keySize + t.order*uvarintLen(0)
+	if size := max(leafSize, nonLeafSize); size > s.pageSize {
+		return fmt.Errorf("%w: a full node of order %d needs at least %d bytes, but pages are %d bytes", ErrPageFull, t.order, size, s.pageSize)
+	}
+	return nil
+}
+
+// on a stored tree, check that putting the record into the leaf leaves every node the change touches within a page,
+// so that a record that is too large is turned away with ErrPageFull before anything in the tree changes
+// the record goes in at the index, in place of the record there if replacing is set, and the leaf is nil while the tree has no records
+func (t *Tree[T]) checkFits(leaf *node[T], idx int, record Record[T], replacing bool) error {
+	s := t.store
+	if s == nil {
+		return nil
+	}
+
+	keys := make([]T, 0, t.order)
+	sizes := make([]int, 0, t.order)
+	depth := 0
+	if leaf != nil {
+		for i := range leaf.numKeys {
+			size, err := s.entrySize(leaf.keys[i], leaf.pointers[i].(Record[T]))
+			if err != nil {
+				return err
+			}
+			keys, sizes = append(keys, leaf.keys[i]), append(sizes, size)
+		}
+		for n := leaf; n != nil; n = n.parent {
+			depth++
+		}
+	}
+
+	size, err := s.entrySize(record.GetHashableVal(), record)
+	if err != nil {
+		return err
+	}
+	if replacing {
+		sizes[idx] = size
+	} else {
+		keys, sizes = slices.Insert(keys, idx, record.GetHashableVal()), slices.Insert(sizes, idx, size)
+	}
+
+	// every node the change allocates is either a free page or one past the end of the file, so links stay below this
+	lastPageID := s.pageCount + uint64(depth) + 1
+	leafSize := func(sizes []int) int {
+		return PAGE_HEADER_SIZE + uvarintLen(uint64(len(sizes))) + uvarintLen(lastPageID) + sum(sizes)
+	}
+	nonLeafSize := func(sizes []int) int {
+		return PAGE_HEADER_SIZE + uvarintLen(uint64(len(sizes))) + sum(sizes) + (len(sizes)+1)*uvarintLen(lastPageID)
+	}
+
+	if len(sizes) <= t.maxKeysPerNode {
+		return s.checkPageSize(leafSize(sizes))
+	}
+
+	// a full leaf splits the way insertIntoLeaf splits it, and the first key of the new leaf goes up into the parent
+	if err := s.checkPageSize(max(leafSize(sizes[:t.leafSplitIndex+1]), leafSize(sizes[t.leafSplitIndex+1:]))); err != nil {
+		return err
+	}
+	separator, err := s.keySize(keys[t.leafSplitIndex+1])
+	if err != nil {
+		return err
+	}
+
+	for child := leaf; ; child = child.parent {
+		if child.parent == nil {
+			return s.checkPageSize(nonLeafSize([]int{separator}))
+		}
+
+		parent := t.fetch(child.parent)
+		pos := t.getNodeIndexInParent(child, parent)
+		if pos == -1 {
+			// the insert finds the tree to be broken here as well, and reports it
+			return nil
+		}
+
+		sizes = make([]int, 0, t.order)
+		for _, key := range parent.keys[:parent.numKeys] {
+			size, err := s.keySize(key)
+			if err != nil {
+				return err
+			}
+			sizes = append(sizes, size)
+		}
+		sizes = slices.Insert(sizes, pos, separator)
+
+		if len(sizes) <= t.maxKeysPerNode {
+			return s.checkPageSize(nonLeafSize(sizes))
+		}
+
+		// a full nonleaf splits the way insertIntoParentNode splits it, and its middle key goes up
+		if err := s.checkPageSize(max(nonLeafSize(sizes[:t.leafSplitIndex]), nonLeafSize(sizes[t.leafSplitIndex+1:]))); err != nil {
+			return err
+		}
+		separator = sizes[t.leafSplitIndex]
+	}
+}
+
+// the bytes a key and its record take up in a leaf's page
+func (s *pageStore[T]) entrySize(key T, record Record[T]) (int, error) {
+	keySize, err := s.keySize(key)
+	if err != nil {
+		return 0, err
+	}
+	data, err := s.codec.EncodeRecord(record)
+	if err != nil {
+		return 0, err
+	}
+	return keySize + uvarintLen(uint64(len(data))) + len(data), nil
+}
+
+// the bytes a key takes up in a page
+func (s *pageStore[T]) keySize(key T) (int, error) {
+	data, err := s.codec.EncodeKey(key)
+	if err != nil {
+		return 0, err
+	}
+	return uvarintLen(uint64(len(data))) + len(data), nil
+}
+
+func (s *pageStore[T]) checkPageSize(size int) error {
+	if size > s.pageSize {
+		return fmt.Errorf("%w: the change needs a node of %d bytes, but pages are %d bytes", ErrPageFull, size, s.pageSize)
+	}
+	return nil
+}
+
+func uvarintLen(x uint64) int {
+	return len(binary.AppendUvarint(nil, x))
+}
+
+func sum(sizes []int) int {
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+	return total
+}
+
+// the number of levels above the leaves, found by walking down the left edge of the tree
+func (s *pageStore[T]) height(pageID uint64) (int, error) {
+	for height := 0; uint64(height) < s.pageCount; height++ {
+		if pageID == META_PAGE_ID || pageID >= s.pageCount {
+			return 0, fmt.Errorf("%w: link to page %d, but there are %d pages", ErrCorruptPage, pageID, s.pageCount)
+		}
+
+		r, err := s.readPage(pageID, pageTypeLeaf, pageTypeNonLeaf)
+		if err != nil {
+			return 0, err
+		}
+		if r.page[4] == pageTypeLeaf {
+			return height, nil
+		}
+
+		// skip over the keys to the first child
+		numKeys := r.uvarint()
+		for i := uint64(0); i < numKeys && r.err == nil; i++ {
+			r.bytes()
+		}
+		pageID = r.uvarint()
+		if err := r.check(pageID, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	return 0, fmt.Errorf("%w: the tree has more levels than pages", ErrCorruptPage)
+}
+
+// read the node stored in the page into memory, and make it resident
+// level is the number of levels above the leaves that the page is linked from, which it has to be on
+func (s *pageStore[T]) load(t *Tree[T], pageID uint64, level int) (*node[T], error) {
+	if pageID == META_PAGE_ID || pageID >= s.pageCount {
+		return nil, fmt.Errorf("%w: link to page %d, but there are %d pages", ErrCorruptPage, pageID, s.pageCount)
+	}
+
+	r, err := s.readPage(pageID, pageTypeLeaf, pageTypeNonLeaf)
+	if err != nil {
+		return nil, err
+	}
+	isLeaf := r.page[4] == pageTypeLeaf
+	if isLeaf != (level == 0) {
+		return nil, fmt.Errorf("%w: page %d is not on the level it is linked from", ErrCorruptPage, pageID)
+	}
+
+	numKeys := r.uvarint()
+	if numKeys > uint64(t.maxKeysPerNode) {
+		return nil, fmt.Errorf("%w: page %d has %d keys, but the order is %d", ErrCorruptPage, pageID, numKeys, t.order)
+	}
+
+	keys := make([]T, t.maxKeysPerNode)
+	pointers := make([]interface{}, t.order)
+
+	if isLeaf {
+		if next := r.uvarint(); next != 0 {
+			pointers[t.maxLeafPointers] = pageLink(next)
+		}
+	}
+
+	for i := range int(numKeys) {
+		if keys[i], err = s.codec.DecodeKey(r.bytes()); err != nil || r.err != nil {
+			return nil, r.check(pageID, err)
+		}
+		if isLeaf {
+			if pointers[i], err = s.codec.DecodeRecord(r.bytes()); err != nil || r.err != nil {
+				return nil, r.check(pageID, err)
+			}
+		}
+	}
+
+	if !isLeaf {
+		for i := range int(numKeys) + 1 {
+			pointers[i] = pageLink(r.uvarint())
+		}
+	}
+
+	if err := r.check(pageID, nil); err != nil {
+		return nil, err
+	}
+
+	n := &node[T]{
+		isLeaf:   isLeaf,
+		keys:     keys,
+		pointers: pointers,
+		numKeys:  int(numKeys),
+		pageID:   pageID,
+		level:    level,
+	}
+	s.nodes[pageID] = n
+	n.frame = s.pool.lru.PushFront(n)
+	return n, nil
+}
+
+func (s *pageStore[T]) loadFreeList(pageID uint64) ([]uint64, error) {
+	free := make([]uint64, 0)
+	for pageID != 0 {
+		if pageID >= s.pageCount || len(free) >= int(s.pageCount) {
+			return nil, fmt.Errorf("%w: bad free page %d", ErrCorruptPage, pageID)
+		}
+
+		r, err := s.readPage(pageID, pageTypeFree)
+		if err != nil {
+			return nil, err
+		}
+
+		free = append(free, pageID)
+		next := r.uvarint()
+		if err := r.check(pageID, nil); err != nil {
+			return nil, err
+		}
+		pageID = next
+	}
+
+	// the list is popped from the end, so reverse it to hand pages out in the same order as before
+	for i, j := 0, len(free)-1; i < j; i, j = i+1, j-1 {
+		free[i], free[j] = free[j], free[i]
+	}
+	return free, nil
+}
+
+// what the meta page records about the tree
+type metaPage struct {
+	pageSize        int
+	order           int
+	allowDuplicates bool
+	rootPageID      uint64
+	pageCount       uint64
+	freePageID      uint64
+}
+
+func (s *pageStore[T]) encodeMeta(t *Tree[T]) []byte {
+	page := s.newPage(pageTypeMeta)
+	page = append(page, pageFileMagic...)
+	page = binary.AppendUvarint(page, uint64(s.pageSize))
+	page = binary.AppendUvarint(page, uint64(t.order))
+
+	var flags uint64
+	if t.allowDuplicates {
+		flags |= 1
+	}
+	page = binary.AppendUvarint(page, flags)
+
+	var rootPageID uint64
+	if t.root != nil {
+		rootPageID = t.root.pageID
+	}
+	page = binary.AppendUvarint(page, rootPageID)
+	page = binary.AppendUvarint(page, s.pageCount)
+
+	var freePageID uint64
+	if len(s.free) > 0 {
+		freePageID = s.free[len(s.free)-1]
+	}
+	return binary.AppendUvarint(page, freePageID)
+}
+
+func readMetaPage(file File) (*metaPage, error) {
+	// the page size is stored in the meta page itself, so start by reading the smallest page there can be
+	page := make([]byte, MIN_PAGE_SIZE)
+	if _, err := file.ReadAt(page, META_PAGE_ID); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	header := page[PAGE_HEADER_SIZE:]
+	if page[4] != pageTypeMeta || len(header) < len(pageFileMagic) || string(header[:len(pageFileMagic)]) != string(pageFileMagic) {
+		return nil, fmt.Errorf("%w: not a tree file", ErrCorruptPage)
+	}
+
+	r := &pageReader{page: page, offset: PAGE_HEADER_SIZE + len(pageFileMagic)}
+	pageSize := r.uvarint()
+	if r.err != nil || pageSize < MIN_PAGE_SIZE || pageSize > 1<<30 {
+		return nil, fmt.Errorf("%w: bad page size", ErrCorruptPage)
+	}
+
+	page = make([]byte, pageSize)
+	if _, err := file.ReadAt(page, META_PAGE_ID); err != nil {
+		return nil, err
+	}
+
+	r, err := checkPage(META_PAGE_ID, page, pageTypeMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	r.offset += len(pageFileMagic)
+	meta := &metaPage{
+		pageSize: int(r.uvarint()),
+		order:    int(r.uvarint()),
+	}
+	meta.allowDuplicates = r.uvarint()&1 != 0
+	meta.rootPageID = r.uvarint()
+	meta.pageCount = r.uvarint()
+	meta.freePageID = r.uvarint()
+
+	if r.err != nil || meta.order < MIN_ORDER || meta.pageCount == 0 {
+		return nil, fmt.Errorf("%w: bad meta page", ErrCorruptPage)
+	}
+	return meta, nil
+}
+
+func appendBytes(page []byte, data []byte) []byte {
+	page = binary.AppendUvarint(page, uint64(len(data)))
+	return append(page, data...)
+}
+
+// reads the fields of a page in order, remembering the first error
+type pageReader struct {
+	page   []byte
+	offset int
+	err    error
+}
+
+func (r *pageReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	val, n := binary.Uvarint(r.page[r.offset:])
+	if n <= 0 {
+		r.err = errors.New("bad number at offset " + strconv.Itoa(r.offset))
+		return 0
+	}
+	r.offset += n
+	return val
+}
+
+func (r *pageReader) bytes() []byte {
+	length := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+
+	if length > uint64(len(r.page)-r.offset) {
+		r.err = errors.New("length runs off the end of the page at offset " + strconv.Itoa(r.offset))
+		return nil
+	}
+	data := r.page[r.offset : r.offset+int(length)]
+	r.offset += int(length)
+	return data
+}
+
+// turn a decoding failure on the page into an error
+func (r *pageReader) check(pageID uint64, err error) error {
+	if r.err != nil {
+		return fmt.Errorf("%w: page %d: %v", ErrCorruptPage, pageID, r.err)
+	}
+	if err != nil {
+		return fmt.Errorf("bptree: decoding page %d: %w", pageID, err)
+	}
+	return nil
+}
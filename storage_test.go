@@ -0,0 +1,197 @@
+package bptree
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestOpenPersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+
+	tree, err := Open[int](path, IntRecordCodec{}, WithOrder(5), WithPageSize(256))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	expected := make(map[int]bool)
+	for round := range 5 {
+		for range 300 {
+			val := r.Intn(500)
+			if r.Intn(3) == 0 && len(expected) > 0 {
+				tree.Delete(val)
+				delete(expected, val)
+			} else {
+				tree.Insert(NewIntRecord(val))
+				expected[val] = true
+			}
+		}
+
+		structure := tree.String()
+		if err := tree.Close(); err != nil {
+			t.Fatalf("Round %d: unexpected error on close: %v", round, err)
+		}
+
+		// the order and page size come from the file, not the options
+		tree, err = Open[int](path, IntRecordCodec{}, WithOrder(3))
+		if err != nil {
+			t.Fatalf("Round %d: unexpected error on reopen: %v", round, err)
+		}
+
+		if tree.Order() != 5 {
+			t.Errorf("Round %d: expected the order to be kept, got %d", round, tree.Order())
+		}
+		if tree.String() != structure {
+			t.Errorf("Round %d: structure changed across a restart:\nbefore:\n%s\nafter:\n%s\n", round, structure, tree.String())
+		}
+
+		expectedArr := make([]int, 0)
+		for val := range expected {
+			expectedArr = append(expectedArr, val)
+		}
+		slices.Sort(expectedArr)
+		if keys := collectKeys(tree.FindRange(-1, 500)); !slices.Equal(keys, expectedArr) {
+			t.Errorf("Round %d: contents changed across a restart:\nExpected: %v\nGot: %v", round, expectedArr, keys)
+		}
+
+		// the links back between leaves are not stored, so they have to be rebuilt
+		slices.Reverse(expectedArr)
+		if keys := collectKeys(tree.FindRangeReverse(500, -1)); !slices.Equal(keys, expectedArr) {
+			t.Errorf("Round %d: contents in reverse changed across a restart:\nExpected: %v\nGot: %v", round, expectedArr, keys)
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("Unexpected error on close: %v", err)
+	}
+	if err := tree.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected closing twice to return ErrClosed, got %v", err)
+	}
+}
+
+func TestOpenReusesFreedPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+
+	tree, err := Open[int](path, IntRecordCodec{}, WithPageSize(128))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for round := range 5 {
+		for i := range 200 {
+			tree.Insert(NewIntRecord(i))
+		}
+		for i := range 200 {
+			tree.Delete(i)
+		}
+
+		// reopen in between, so that the free list is read back from the file
+		if err := tree.Close(); err != nil {
+			t.Fatalf("Round %d: unexpected error on close: %v", round, err)
+		}
+		if tree, err = Open[int](path, IntRecordCodec{}); err != nil {
+			t.Fatalf("Round %d: unexpected error on reopen: %v", round, err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// a single round needs well under 200 pages
+	if info.Size() > 200*128 {
+		t.Errorf("Expected freed pages to be reused, but the file grew to %d bytes", info.Size())
+	}
+	tree.Close()
+}
+
+func TestOpenDetectsCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+
+	tree, err := Open[int](path, IntRecordCodec{}, WithPageSize(128))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := range 50 {
+		tree.Insert(NewIntRecord(i))
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("Unexpected error on close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// flip a byte in the middle of the first node page
+	data[128+20] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := Open[int](path, IntRecordCodec{}); !errors.Is(err, ErrCorruptPage) || !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorruptPage, got %v", err)
+	}
+}
+
+func TestOpenRejectsOrderLargerThanAPage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+
+	if _, err := Open[int](path, IntRecordCodec{}, WithOrder(200), WithPageSize(128)); !errors.Is(err, ErrPageFull) {
+		t.Errorf("Expected ErrPageFull, got %v", err)
+	}
+}
+
+func TestInsertRejectsRecordsLargerThanAPage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+
+	tree, err := Open[int](path, IntRecordCodec{}, WithOrder(16), WithPageSize(128), WithWAL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// small keys fit a full node, but large ones take more bytes each, until a node of them does not fit
+	for i := range 30 {
+		if err := tree.Insert(NewIntRecord(i)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	var before []int
+	for i := range 60 {
+		before = treeKeys(tree)
+		err = tree.Insert(NewIntRecord(1<<40 + i))
+		if err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrPageFull) {
+		t.Fatalf("Expected ErrPageFull, got %v", err)
+	}
+
+	// the record was turned away without changing the tree, which can still take changes
+	if keys := treeKeys(tree); !slices.Equal(keys, before) {
+		t.Errorf("Expected the tree to be left as it was:\nExpected: %v\nGot: %v", before, keys)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Errorf("Expected the tree to be valid, got %v", err)
+	}
+	if err := tree.Insert(NewIntRecord(30)); err != nil || tree.Err() != nil {
+		t.Errorf("Expected the tree to take changes, got %v and %v", err, tree.Err())
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("Unexpected error on close: %v", err)
+	}
+
+	reopened, err := Open[int](path, IntRecordCodec{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer reopened.Close()
+	if keys := treeKeys(reopened); len(keys) != len(before)+1 {
+		t.Errorf("Expected %d keys after reopening, got %v", len(before)+1, keys)
+	}
+}
@@ -0,0 +1,322 @@
+package bptree
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+)
+
+var ErrConflict = errors.New("bptree: transaction conflicts with a change committed since it began")
+
+// Txn groups inserts and deletes so that they are applied to the tree all at once, or not at all
+//
+// Changes are kept in the transaction until it commits, so the tree does not see any of them before then,
+// while the transaction's own reads see them on top of the tree as it is when they run
+// A transaction is not safe for concurrent use
+type Txn[T cmp.Ordered] struct {
+	tree *Tree[T]
+
+	// the latest change to each key the transaction wrote, in key order
+	writes   *Tree[T]
+	finished bool
+}
+
+// a change that a transaction made to a key
+type txnWrite[T cmp.Ordered] struct {
+	key T
+	// nil if the transaction deleted the key
+	record Record[T]
+	// whether the tree had the key when the transaction first wrote it, which has to still hold when it commits
+	existed bool
+}
+
+func (w *txnWrite[T]) GetHashableVal() T {
+	return w.key
+}
+
+func (w *txnWrite[T]) String() string {
+	return fmt.Sprint(w.key)
+}
+
+// Begin starts a transaction on a tree that does not allow duplicates
+func (t *Tree[T]) Begin() *Txn[T] {
+	if t.allowDuplicates {
+		panic("Transactions are only supported for trees that do not allow duplicates")
+	}
+
+	return &Txn[T]{
+		tree:   t,
+		writes: NewTree[T](WithOrder(t.order)),
+	}
+}
+
+// the change the transaction made to the key, or nil if it has not written it
+func (tx *Txn[T]) write(val T) *txnWrite[T] {
+	if tx.writes.isEmpty() {
+		return nil
+	}
+
+	record, _ := tx.writes.FindPoint(val)
+	w, _ := record.(*txnWrite[T])
+	return w
+}
+
+// the record stored under the key as the transaction sees it, or nil if there is none, along with the transaction's change to it if it made one
+func (tx *Txn[T]) lookup(val T) (Record[T], *txnWrite[T], error) {
+	if w := tx.write(val); w != nil {
+		return w.record, w, nil
+	}
+
+	record, err := tx.tree.lookup(val)
+	return record, nil, err
+}
+
+// Insert adds the record, or returns ErrDuplicate without changing anything if its key is already present as the transaction sees it
+func (tx *Txn[T]) Insert(record Record[T]) error {
+	tx.checkOpen()
+
+	val := record.GetHashableVal()
+	existing, w, err := tx.lookup(val)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("%w: %v", ErrDuplicate, val)
+	}
+
+	tx.writes.Upsert(&txnWrite[T]{
+		key:     val,
+		record:  record,
+		existed: w != nil && w.existed,
+	})
+	return nil
+}
+
+// Delete removes the record stored under the key, or returns ErrNotFound if it is not there as the transaction sees it
+func (tx *Txn[T]) Delete(val T) error {
+	tx.checkOpen()
+
+	existing, w, err := tx.lookup(val)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return notFound(val)
+	}
+
+	tx.writes.Upsert(&txnWrite[T]{
+		key:     val,
+		existed: w == nil || w.existed,
+	})
+	return nil
+}
+
+// FindPoint returns the record stored under the key as the transaction sees it, or ErrNotFound if there is none
+func (tx *Txn[T]) FindPoint(val T) (Record[T], error) {
+	tx.checkOpen()
+
+	record, _, err := tx.lookup(val)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, notFound(val)
+	}
+	return record, nil
+}
+
+// FindRange iterates over the records that satisfy low <= x < high as the transaction sees them
+func (tx *Txn[T]) FindRange(low T, high T) Iterator[T] {
+	tx.checkOpen()
+
+	n := &txnIterator[T]{
+		records: NewSliceIterator[T](nil),
+		writes:  NewSliceIterator[T](nil),
+	}
+	if !tx.tree.isEmpty() {
+		n.records = tx.tree.FindRange(low, high)
+	}
+	if !tx.writes.isEmpty() {
+		n.writes = tx.writes.FindRange(low, high)
+	}
+
+	n.nextRecord = n.records.Next()
+	n.nextWrite, _ = n.writes.Next().(*txnWrite[T])
+	return n
+}
+
+// Commit applies every change the transaction made to the tree at once
+// If another change to the tree since the transaction wrote a key means that the change no longer applies,
+// such as a key it inserted being inserted by someone else, nothing is applied and ErrConflict is returned
+// If the tree fails to store the changes, or a record is too large for a page of the tree's file,
+// the ones already applied are undone and the error is returned
+func (tx *Txn[T]) Commit() (err error) {
+	tx.checkOpen()
+	tx.finished = true
+
+	t := tx.tree
+	defer t.catchCorrupt(&err)
+	_, unlock := t.lockTree(latchNone)
+	defer unlock()
+	defer t.release()
+
+	if !t.writable() {
+		if t.store.err != nil {
+			return t.store.err
+		}
+		return ErrClosed
+	}
+	defer t.validateChange("Commit")()
+
+	writes := tx.allWrites()
+	for _, w := range writes {
+		if (t.findLatest(w.key, latchNone) != nil) != w.existed {
+			return fmt.Errorf("%w: key %v", ErrConflict, w.key)
+		}
+	}
+
+	// on a versioned tree, the whole transaction is a single version
+	if t.versioned {
+		t.versions.batch, t.versions.batchStart = true, t.versions.current
+		defer func() {
+			t.versions.batch = false
+		}()
+	}
+
+	// what each key held before the transaction, so that the changes can be undone
+	undo := make([]*txnWrite[T], 0, len(writes))
+	for _, w := range writes {
+		if w.record != nil {
+			previous, _, err := t.insertRecord(w.record, true, latchNone)
+			if err != nil {
+				// a record too large for a page turns the whole transaction away, while the tree can still take changes
+				t.undoWrites(undo)
+				if commitErr := t.commit(); commitErr != nil {
+					return commitErr
+				}
+				return err
+			}
+			undo = append(undo, &txnWrite[T]{key: w.key, record: previous})
+		} else if w.existed {
+			previous := t.deleteKey(w.key, latchNone)
+			undo = append(undo, &txnWrite[T]{key: w.key, record: previous})
+		}
+		// a key that was inserted and deleted again by the transaction was never in the tree
+	}
+
+	err = t.commit()
+	if err == nil {
+		return nil
+	}
+
+	// the tree refuses changes from now on, but it should not be left showing part of the transaction
+	t.undoWrites(undo)
+	return err
+}
+
+// put back what each key held before the writes of a transaction, from the last write back
+func (t *Tree[T]) undoWrites(undo []*txnWrite[T]) {
+	for i := len(undo) - 1; i >= 0; i-- {
+		if undo[i].record != nil {
+			t.insertRecord(undo[i].record, true, latchNone)
+		} else {
+			t.deleteKey(undo[i].key, latchNone)
+		}
+	}
+}
+
+// Rollback discards every change the transaction made
+// It does nothing once the transaction has committed, so it can be deferred right after Begin
+func (tx *Txn[T]) Rollback() {
+	tx.finished = true
+	tx.writes = nil
+}
+
+func (tx *Txn[T]) checkOpen() {
+	if tx.finished {
+		panic("Transaction is already finished")
+	}
+}
+
+// every change the transaction made, in key order
+func (tx *Txn[T]) allWrites() []*txnWrite[T] {
+	writes := make([]*txnWrite[T], 0)
+	leaf := tx.writes.root
+	if leaf == nil {
+		return writes
+	}
+
+	for !leaf.isLeaf {
+		leaf = leaf.pointers[0].(*node[T])
+	}
+	for leaf != nil {
+		for _, ptr := range leaf.pointers[:leaf.numKeys] {
+			writes = append(writes, ptr.(*txnWrite[T]))
+		}
+		leaf, _ = leaf.pointers[tx.writes.maxLeafPointers].(*node[T])
+	}
+	return writes
+}
+
+// the latest record stored under the key, or nil if there is none, without the error FindPoint would return for a missing key
+func (t *Tree[T]) lookup(val T) (record Record[T], err error) {
+	defer t.catchCorrupt(&err)
+
+	mode, unlock := t.lockTree(latchRead)
+	defer unlock()
+	defer t.release()
+
+	return t.findLatest(val, mode), nil
+}
+
+// the latest record stored under the key in a tree that is already locked, with the mode it was locked in
+func (t *Tree[T]) findLatest(val T, mode latchMode) Record[T] {
+	if t.isEmpty() {
+		return nil
+	}
+
+	leaf, idx, latches := t.findFirst(val, mode)
+	defer latches.release()
+	if leaf == nil {
+		return nil
+	}
+	return t.recordAt(leaf, idx, latestVersion)
+}
+
+// merges the records in the tree with the changes a transaction made, which take the place of the records with the same key
+type txnIterator[T cmp.Ordered] struct {
+	records Iterator[T]
+	writes  Iterator[T]
+
+	nextRecord Record[T]
+	nextWrite  *txnWrite[T]
+}
+
+func (n *txnIterator[T]) Next() Record[T] {
+	for n.nextRecord != nil || n.nextWrite != nil {
+		if n.nextWrite == nil || (n.nextRecord != nil && n.nextRecord.GetHashableVal() < n.nextWrite.key) {
+			record := n.nextRecord
+			n.nextRecord = n.records.Next()
+			return record
+		}
+
+		w := n.nextWrite
+		n.nextWrite, _ = n.writes.Next().(*txnWrite[T])
+		if n.nextRecord != nil && n.nextRecord.GetHashableVal() == w.key {
+			n.nextRecord = n.records.Next()
+		}
+
+		if w.record != nil {
+			return w.record
+		}
+	}
+
+	return nil
+}
+
+func (n *txnIterator[T]) Err() error {
+	if err := n.records.Err(); err != nil {
+		return err
+	}
+	return n.writes.Err()
+}
@@ -0,0 +1,212 @@
+package bptree
+
+import (
+	"errors"
+	"maps"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestTxnSeesItsOwnWrites(t *testing.T) {
+	tree := NewTree[int]()
+	for val := range 10 {
+		tree.Insert(NewIntRecord(val))
+	}
+
+	tx := tree.Begin()
+	defer tx.Rollback()
+
+	if err := tx.Insert(NewIntRecord(5)); !errors.Is(err, ErrDuplicate) || err.Error() != "bptree: duplicate key: 5" {
+		t.Errorf("Expected ErrDuplicate for a key that is in the tree, got %v", err)
+	}
+	for _, err := range []error{tx.Insert(NewIntRecord(20)), tx.Delete(3), tx.Delete(20), tx.Insert(NewIntRecord(15))} {
+		if err != nil {
+			t.Errorf("Expected the changes to go through, got %v", err)
+		}
+	}
+	if err := tx.Delete(3); !errors.Is(err, ErrNotFound) || err.Error() != "bptree: record not found: 3" {
+		t.Errorf("Expected ErrNotFound for a key the transaction deleted, got %v", err)
+	}
+
+	for _, val := range []int{3, 20} {
+		if record, err := tx.FindPoint(val); record != nil || !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for %d, got %v and %v", val, record, err)
+		}
+	}
+	for _, val := range []int{15, 4} {
+		if record, err := tx.FindPoint(val); err != nil || record.GetHashableVal() != val {
+			t.Errorf("Expected the record for %d, got %v and %v", val, record, err)
+		}
+	}
+	if keys := collectKeys(tx.FindRange(0, 100)); !slices.Equal(keys, []int{0, 1, 2, 4, 5, 6, 7, 8, 9, 15}) {
+		t.Errorf("Expected the transaction's range to include its writes, got %v", keys)
+	}
+
+	// nothing is visible outside of the transaction before it commits
+	if keys := collectKeys(tree.FindRange(0, 100)); !slices.Equal(keys, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Errorf("Expected the tree to be unchanged, got %v", keys)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if keys := collectKeys(tree.FindRange(0, 100)); !slices.Equal(keys, []int{0, 1, 2, 4, 5, 6, 7, 8, 9, 15}) {
+		t.Errorf("Expected the changes after committing, got %v", keys)
+	}
+}
+
+func TestTxnRandomCommitsAndRollbacks(t *testing.T) {
+	tree := NewTree[int](WithOrder(3))
+	expected := make(map[int]bool)
+	r := rand.New(rand.NewSource(1))
+
+	for range 200 {
+		tx := tree.Begin()
+		view := maps.Clone(expected)
+
+		for range r.Intn(50) {
+			val := r.Intn(200)
+			if r.Intn(2) == 0 {
+				if err := tx.Insert(NewIntRecord(val)); errors.Is(err, ErrDuplicate) != view[val] {
+					t.Fatalf("Insert of %d did not match what the transaction should see", val)
+				}
+				view[val] = true
+			} else {
+				if err := tx.Delete(val); errors.Is(err, ErrNotFound) == view[val] {
+					t.Fatalf("Delete of %d did not match what the transaction should see", val)
+				}
+				delete(view, val)
+			}
+		}
+
+		if keys := collectKeys(tx.FindRange(0, 200)); !slices.Equal(keys, slices.Sorted(maps.Keys(view))) {
+			t.Fatalf("Transaction's range did not match:\nExpected: %v\nGot: %v", slices.Sorted(maps.Keys(view)), keys)
+		}
+
+		if r.Intn(2) == 0 {
+			tx.Rollback()
+		} else {
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expected = view
+		}
+
+		if keys := treeKeys(tree); !slices.Equal(keys, slices.Sorted(maps.Keys(expected))) {
+			t.Fatalf("Tree did not match:\nExpected: %v\nGot: %v", slices.Sorted(maps.Keys(expected)), keys)
+		}
+	}
+	checkParents(t, tree.root)
+}
+
+func TestTxnConflict(t *testing.T) {
+	tree := NewTree[int]()
+	tree.Insert(NewIntRecord(1))
+
+	tx := tree.Begin()
+	tx.Insert(NewIntRecord(2))
+	tx.Delete(1)
+	tx.Insert(NewIntRecord(3))
+
+	// someone else inserts one of the keys first
+	tree.Insert(NewIntRecord(3))
+
+	if err := tx.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected a conflict, got %v", err)
+	}
+	if keys := treeKeys(tree); !slices.Equal(keys, []int{1, 3}) {
+		t.Errorf("Expected nothing from the transaction to be applied, got %v", keys)
+	}
+}
+
+func TestTxnIsASingleVersion(t *testing.T) {
+	tree := NewTree[int](WithVersions())
+	tree.Insert(NewIntRecord(1))
+
+	tx := tree.Begin()
+	for val := 2; val < 50; val++ {
+		tx.Insert(NewIntRecord(val))
+	}
+	tx.Delete(1)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if tree.Version() != 2 {
+		t.Errorf("Expected the transaction to be version 2, got %d", tree.Version())
+	}
+	if keys := collectKeys(tree.FindRange(0, 100, AsOf(1))); !slices.Equal(keys, []int{1}) {
+		t.Errorf("Expected only the first record before the transaction, got %v", keys)
+	}
+	if keys := collectKeys(tree.FindRange(0, 100, AsOf(2))); len(keys) != 48 {
+		t.Errorf("Expected every change from the transaction at once, got %v", keys)
+	}
+}
+
+func TestTxnIsUndoneWhenTheTreeFailsToStoreIt(t *testing.T) {
+	fs := newFaultFS()
+	tree, err := Open[int]("tree.db", IntRecordCodec{}, WithFS(fs), WithWAL(), WithPageSize(128))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for val := range 20 {
+		tree.Insert(NewIntRecord(val))
+	}
+
+	// enough changes to split and merge nodes
+	tx := tree.Begin()
+	for val := range 10 {
+		tx.Delete(val)
+	}
+	for val := 100; val < 150; val++ {
+		tx.Insert(NewIntRecord(val))
+	}
+
+	fs.failAt = fs.writePoints + 1
+	if err := tx.Commit(); !errors.Is(err, errInjected) {
+		t.Fatalf("Expected the injected fault, got %v", err)
+	}
+
+	expected := make([]int, 0)
+	for val := range 20 {
+		expected = append(expected, val)
+	}
+	if keys := treeKeys(tree); !slices.Equal(keys, expected) {
+		t.Errorf("Expected the transaction to be undone:\nExpected: %v\nGot: %v", expected, keys)
+	}
+
+	// the write that faulted may or may not have made it to the log, but either way the transaction is all there or not at all
+	committed := make([]int, 0)
+	for val := 10; val < 20; val++ {
+		committed = append(committed, val)
+	}
+	for val := 100; val < 150; val++ {
+		committed = append(committed, val)
+	}
+	for seed := range 10 {
+		reopened, err := Open[int]("tree.db", IntRecordCodec{}, WithFS(fs.crash(rand.New(rand.NewSource(int64(seed))))))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if keys := treeKeys(reopened); !slices.Equal(keys, expected) && !slices.Equal(keys, committed) {
+			t.Errorf("Expected all or none of the transaction after reopening, got %v", keys)
+		}
+	}
+}
+
+func TestTxnPanicsOnceFinished(t *testing.T) {
+	tree := NewTree[int]()
+	tx := tree.Begin()
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tx.Rollback()
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic")
+		}
+	}()
+	tx.Insert(NewIntRecord(1))
+}
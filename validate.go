@@ -0,0 +1,253 @@
+package bptree
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// ValidationError lists every way in which Validate found the structure of a tree to be broken
+// It matches ErrCorrupt, and each of its violations can be found with errors.As as well
+type ValidationError struct {
+	Violations []*CorruptError
+}
+
+func (e *ValidationError) Error() string {
+	return "bptree: tree is corrupt, " + e.list()
+}
+
+// the number of violations, followed by each of them on a line of its own
+func (e *ValidationError) list() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "found %d violations:", len(e.Violations))
+	for _, v := range e.Violations {
+		fmt.Fprintf(&b, "\n\t%s, at %s", v.Reason, strings.Join(v.Path, " > "))
+	}
+	return b.String()
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		errs = append(errs, v)
+	}
+	return errs
+}
+
+// Validate checks the structure of the whole tree, and returns a ValidationError listing every violation it finds, or nil if there is none
+//
+// The keys have to be in order within each node and between the separators above it, every leaf has to be at the same depth,
+// every node other than the root has to be within its minimum and maximum number of keys, every child has to point back to its parent,
+// and the links between the leaves have to visit every leaf in order, both ways
+// A tree stored in a file is read into memory in full while it is checked, and only has links from each leaf to the next
+func (t *Tree[T]) Validate() (err error) {
+	defer t.catchCorrupt(&err)
+
+	_, unlock := t.lockTree(latchNone)
+	defer unlock()
+	defer t.release()
+
+	if violations := t.validate(); len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// walks the tree once from the root, keeping the path it took
+// the path is used for the violations rather than the parent pointers, which can be among the things that are broken
+type validator[T cmp.Ordered] struct {
+	tree       *Tree[T]
+	path       []string
+	violations []*CorruptError
+
+	// every node reached so far, so that a node that is reached twice is not walked again
+	seen      map[*node[T]]bool
+	leafDepth int
+	// the leaves in the order the walk reached them, which the links between them have to follow, and the path to each
+	leaves    []*node[T]
+	leafPaths [][]string
+}
+
+// the tree has to be locked already
+func (t *Tree[T]) validate() []*CorruptError {
+	if t.root == nil {
+		return nil
+	}
+
+	v := &validator[T]{
+		tree:      t,
+		seen:      make(map[*node[T]]bool),
+		leafDepth: -1,
+	}
+	root := t.fetch(t.root)
+	if root.parent != nil {
+		v.path = append(v.path, describeNode(root))
+		v.violate("the root has a parent")
+		v.path = v.path[:0]
+	}
+	v.walk(root, 0, nil, nil)
+	v.checkLeafLinks()
+	return v.violations
+}
+
+func (v *validator[T]) violate(reason string, args ...any) {
+	v.violations = append(v.violations, &CorruptError{
+		Reason: fmt.Sprintf(reason, args...),
+		Path:   append([]string(nil), v.path...),
+	})
+}
+
+// check the node and everything under it, which has to be within the separators low and high, where nil leaves that end open
+func (v *validator[T]) walk(n *node[T], depth int, low *T, high *T) {
+	t := v.tree
+	v.path = append(v.path, describeNode(n))
+	defer func() {
+		v.path = v.path[:len(v.path)-1]
+	}()
+
+	if v.seen[n] {
+		v.violate("the node is reachable more than once")
+		return
+	}
+	v.seen[n] = true
+
+	if n.numKeys < 0 || n.numKeys > t.maxKeysPerNode {
+		v.violate("the node has %d keys, more than the maximum of %d", n.numKeys, t.maxKeysPerNode)
+		return
+	}
+	minKeys := t.minNonLeafKeys
+	if n.isLeaf {
+		minKeys = t.minLeafKeys
+	}
+	if n == t.root {
+		if !n.isLeaf && n.numKeys == 0 {
+			v.violate("the root is a nonleaf node without any keys")
+		}
+	} else if n.numKeys < minKeys {
+		v.violate("the node has %d keys, fewer than the minimum of %d", n.numKeys, minKeys)
+	}
+
+	keys := n.keys[:n.numKeys]
+	for i := 1; i < len(keys); i++ {
+		if keys[i] < keys[i-1] || (keys[i] == keys[i-1] && !t.allowDuplicates) {
+			v.violate("key %v is not in order after %v", keys[i], keys[i-1])
+		}
+	}
+	// records equal to the separator on their right only come before it when duplicates are allowed
+	for _, key := range keys {
+		if low != nil && key < *low {
+			v.violate("key %v is below the separator %v on the left of the node", key, *low)
+		}
+		if high != nil && (key > *high || (key == *high && n.isLeaf && !t.allowDuplicates)) {
+			v.violate("key %v is not below the separator %v on the right of the node", key, *high)
+		}
+	}
+
+	if n.isLeaf {
+		v.checkLeaf(n, depth)
+		return
+	}
+
+	for i, ptr := range n.pointers[:n.numKeys+1] {
+		child, ok := t.follow(ptr, n.level-1)
+		if !ok || child == nil {
+			v.violate("pointer %d is a %T rather than a child node", i, ptr)
+			continue
+		}
+		// on a tree stored in a file, a child that is read from its page only points to its parent once an operation reaches it from there
+		if child.parent != n && (t.store == nil || child.parent != nil) {
+			v.path = append(v.path, describeNode(child))
+			v.violate("child %d does not point back to the node as its parent", i)
+			v.path = v.path[:len(v.path)-1]
+		}
+
+		childLow, childHigh := low, high
+		if i > 0 {
+			childLow = &n.keys[i-1]
+		}
+		if i < n.numKeys {
+			childHigh = &n.keys[i]
+		}
+		v.walk(child, depth+1, childLow, childHigh)
+	}
+}
+
+func (v *validator[T]) checkLeaf(leaf *node[T], depth int) {
+	if v.leafDepth == -1 {
+		v.leafDepth = depth
+	} else if depth != v.leafDepth {
+		v.violate("the leaf is at depth %d, while the first leaf is at depth %d", depth, v.leafDepth)
+	}
+
+	for i, ptr := range leaf.pointers[:leaf.numKeys] {
+		switch p := ptr.(type) {
+		case *recordVersion[T]:
+			if !v.tree.versioned {
+				v.violate("pointer %d is a version of a record in a tree without versions", i)
+			}
+		case Record[T]:
+			if p.GetHashableVal() != leaf.keys[i] {
+				v.violate("the record at %d has the key %v, rather than %v", i, p.GetHashableVal(), leaf.keys[i])
+			}
+		default:
+			v.violate("pointer %d is a %T rather than a record", i, ptr)
+		}
+	}
+
+	v.leaves = append(v.leaves, leaf)
+	v.leafPaths = append(v.leafPaths, append([]string(nil), v.path...))
+}
+
+// the links between leaves have to go through the same leaves as the walk down from the root, in the same order,
+// so that the records are in order from one leaf to the next as well
+func (v *validator[T]) checkLeafLinks() {
+	t := v.tree
+	for i, leaf := range v.leaves {
+		v.path = v.leafPaths[i]
+
+		var prev, next *node[T]
+		if i > 0 {
+			prev = v.leaves[i-1]
+		}
+		if i < len(v.leaves)-1 {
+			next = v.leaves[i+1]
+		}
+
+		// trees stored in a file do not link back
+		if t.store == nil && leaf.prev != prev {
+			v.violate("the leaf links back to %s rather than the leaf before it", linkedNode(leaf.prev))
+		}
+		switch link := leaf.pointers[t.maxLeafPointers].(type) {
+		case *node[T]:
+			if link != next {
+				v.violate("the leaf links on to %s rather than the leaf after it", linkedNode(link))
+			}
+		case pageLink:
+			if next == nil || link != pageLink(next.pageID) {
+				v.violate("the leaf links on to page %d rather than the leaf after it", link)
+			}
+		case nil:
+			if next != nil {
+				v.violate("the leaf does not link on to the leaf after it")
+			}
+		default:
+			v.violate("the link to the next leaf is a %T", link)
+		}
+
+		if prev != nil && prev.numKeys > 0 && leaf.numKeys > 0 {
+			last, first := prev.keys[prev.numKeys-1], leaf.keys[0]
+			if first < last || (first == last && !t.allowDuplicates) {
+				v.violate("key %v is not in order after %v in the leaf before it", first, last)
+			}
+		}
+	}
+	v.path = nil
+}
+
+// how a leaf that a link points to is shown in a violation
+func linkedNode[T cmp.Ordered](n *node[T]) string {
+	if n == nil {
+		return "nothing"
+	}
+	return describeNode(n)
+}
@@ -0,0 +1,113 @@
+package bptree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateAfterRandomChanges(t *testing.T) {
+	configs := map[string][]TreeOption{
+		"order 3":    {WithOrder(3)},
+		"order 4":    {WithOrder(4)},
+		"duplicates": {WithOrder(3), WithDuplicates()},
+		"versions":   {WithOrder(4), WithVersions()},
+		"counts":     {WithOrder(5), WithCounts(), WithAggregate(SumOf(keyOf))},
+	}
+	for name, opts := range configs {
+		t.Run(name, func(t *testing.T) {
+			tree := NewTree[int](opts...)
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("Expected an empty tree to be valid, got %v", err)
+			}
+
+			r := rand.New(rand.NewSource(1))
+			for i := range 3000 {
+				val := r.Intn(300)
+				switch r.Intn(20) {
+				case 0:
+					tree.DeleteRange(val, val+r.Intn(30))
+				case 1, 2, 3, 4, 5, 6, 7:
+					tree.Delete(val)
+				default:
+					tree.Insert(NewIntRecord(val))
+				}
+
+				if i%50 == 0 {
+					if err := tree.Validate(); err != nil {
+						t.Fatalf("Operation %d: %v", i, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidateStoredTree(t *testing.T) {
+	tree, err := Open[int](filepath.Join(t.TempDir(), "tree.db"), IntRecordCodec{}, WithPageSize(128), WithMemoryBudget(4*128))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+
+	for val := range 500 {
+		tree.Insert(NewIntRecord(val))
+	}
+	for val := 0; val < 500; val += 3 {
+		tree.Delete(val)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Errorf("Expected the tree to be valid, got %v", err)
+	}
+}
+
+func TestValidateReportsEveryViolation(t *testing.T) {
+	tree := NewTree[int](WithOrder(4))
+	for val := range 40 {
+		tree.Insert(NewIntRecord(val * 10))
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatalf("Expected the tree to be valid before it is broken, got %v", err)
+	}
+
+	leaves := make([]*node[int], 0)
+	for leaf, _ := tree.findLeftmostNode(0, latchNone); leaf != nil; {
+		leaves = append(leaves, leaf)
+		leaf, _ = leaf.pointers[tree.maxLeafPointers].(*node[int])
+	}
+
+	// keys out of order in one leaf, a stale parent pointer on another, a broken link back from a third,
+	// and a fourth that is short of keys
+	leaves[1].keys[0], leaves[1].keys[1] = leaves[1].keys[1], leaves[1].keys[0]
+	leaves[1].pointers[0], leaves[1].pointers[1] = leaves[1].pointers[1], leaves[1].pointers[0]
+	leaves[4].parent = leaves[0].parent
+	leaves[7].prev = leaves[2]
+	removeKeyAndPointerFromLeaf(leaves[10], 0)
+
+	err := tree.Validate()
+	var validationErr *ValidationError
+	if !errors.Is(err, ErrCorrupt) || !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+
+	expected := []string{
+		fmt.Sprintf("key %d is not in order after %d", leaves[1].keys[1], leaves[1].keys[0]),
+		"does not point back to the node as its parent",
+		"links back to",
+		"fewer than the minimum",
+	}
+	for _, reason := range expected {
+		found := false
+		for _, v := range validationErr.Violations {
+			if strings.Contains(v.Reason, reason) && len(v.Path) > 1 {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected a violation for %q, got:\n%v", reason, err)
+		}
+	}
+}
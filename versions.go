@@ -0,0 +1,333 @@
+package bptree
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// reads that do not ask for a version see the latest one
+const latestVersion = math.MaxUint64
+
+var (
+	// ErrVersionGone is returned by a read as of a version that has been garbage collected
+	ErrVersionGone = errors.New("bptree: version has been garbage collected")
+
+	errNotVersioned = fmt.Errorf("%w: only trees created with WithVersions can be read as of a version", ErrUnsupported)
+)
+
+// WithVersions gives every change to the tree a version, one higher than the last, and keeps the records each key had in earlier versions
+// so that the tree can be read as it was at any version that has not been garbage collected
+// Versions cannot be kept for trees that allow duplicates or that are stored in a file
+func WithVersions() TreeOption {
+	return func(o *treeOptions) {
+		o.versioned = true
+	}
+}
+
+// ReadOption configures a single read of a tree
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	asOf uint64
+}
+
+// AsOf reads the tree as it was right after the change with the version, on a tree created with WithVersions
+// Version 0 is the tree before any change
+// Reads fail with ErrVersionGone if the version has been garbage collected, which a Reader keeps from happening,
+// and with ErrUnsupported on a tree without versions
+func AsOf(version uint64) ReadOption {
+	return func(o *readOptions) {
+		o.asOf = version
+	}
+}
+
+// on a versioned tree, the pointers in the leaves are versions of the key's record, from the newest back
+// each version is never changed once it is in a leaf, so snapshots can share them with the tree
+type recordVersion[T cmp.Ordered] struct {
+	version uint64
+	// nil if the key was deleted in this version
+	record Record[T]
+	older  *recordVersion[T]
+}
+
+type versionState struct {
+	// the version of the latest change
+	current uint64
+	// versions before this have been garbage collected
+	horizon uint64
+
+	// while a transaction commits, every change it makes gets the same version, the first one after batchStart
+	batch      bool
+	batchStart uint64
+
+	mu sync.Mutex
+	// how many open readers there are at each version
+	readers map[uint64]int
+}
+
+// the version a read is for, or ErrUnsupported for a version of a tree without versions
+func (t *Tree[T]) readVersion(opts []ReadOption) (uint64, error) {
+	options := readOptions{
+		asOf: latestVersion,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.asOf != latestVersion && !t.versioned {
+		return 0, errNotVersioned
+	}
+	return options.asOf, nil
+}
+
+// stop the read if the versions it needs are gone, which is turned into ErrVersionGone by catchCorrupt
+// the tree has to be locked
+func (t *Tree[T]) checkVersion(asOf uint64) {
+	if asOf < t.versions.horizon {
+		panic(fmt.Errorf("%w: version %d, the oldest version left is %d", ErrVersionGone, asOf, t.versions.horizon))
+	}
+}
+
+// the record at the index in the leaf as of the version, or nil if the key was deleted by then
+func (t *Tree[T]) recordAt(leaf *node[T], idx int, asOf uint64) Record[T] {
+	switch ptr := leaf.pointers[idx].(type) {
+	case *recordVersion[T]:
+		for v := ptr; v != nil; v = v.older {
+			if v.version <= asOf {
+				return v.record
+			}
+		}
+		return nil
+	case Record[T]:
+		return ptr
+	}
+
+	corrupt(leaf, fmt.Sprintf("could not cast a %T into a record", leaf.pointers[idx]))
+	return nil
+}
+
+// what to store in a leaf for the record, which on a versioned tree is a new version in front of the ones that came before it
+func (t *Tree[T]) leafPointer(record Record[T], previous interface{}) interface{} {
+	if !t.versioned {
+		return record
+	}
+
+	if s := &t.versions; !s.batch || s.current == s.batchStart {
+		s.current++
+	}
+	v := &recordVersion[T]{
+		version: t.versions.current,
+		record:  record,
+	}
+
+	switch ptr := previous.(type) {
+	case *recordVersion[T]:
+		v.older = ptr
+	case Record[T]:
+		// records that were bulk loaded are there from the start
+		v.older = &recordVersion[T]{record: ptr}
+	}
+	return v
+}
+
+// swap the record at the index in the leaf, which on a versioned tree adds a new version for it
+// a nil record deletes the key, which is only possible on a versioned tree
+func (t *Tree[T]) setRecord(leaf *node[T], idx int, record Record[T]) {
+	leaf = t.unshare(leaf)
+	leaf.pointers[idx] = t.leafPointer(record, leaf.pointers[idx])
+	t.markDirty(leaf)
+	t.summarizeUp(leaf)
+}
+
+// delete the record at the index in the leaf
+// on a versioned tree, the key stays until it is garbage collected, since readers of earlier versions can still see it
+func (t *Tree[T]) deleteAt(leaf *node[T], idx int) bool {
+	if !t.versioned {
+		t.deleteFromLeaf(t.unshare(leaf), idx)
+		return true
+	}
+
+	if t.recordAt(leaf, idx, latestVersion) == nil {
+		return false
+	}
+	t.setRecord(leaf, idx, nil)
+	return true
+}
+
+// Version returns the version of the latest change to the tree, which is 0 before the first one
+func (t *Tree[T]) Version() uint64 {
+	_, unlock := t.lockTree(latchRead)
+	defer unlock()
+
+	return t.versions.current
+}
+
+// Reader reads a versioned tree as it was at the version the reader was opened at
+// Until it is closed, the versions it can see are not garbage collected
+type Reader[T cmp.Ordered] struct {
+	tree    *Tree[T]
+	version uint64
+	closed  atomic.Bool
+}
+
+// OpenReader returns a reader of the tree as it is now, or ErrUnsupported on a tree without versions
+func (t *Tree[T]) OpenReader() (*Reader[T], error) {
+	if !t.versioned {
+		return nil, errNotVersioned
+	}
+
+	// keep the version from changing or being collected until the reader is counted
+	_, unlock := t.lockTree(latchRead)
+	defer unlock()
+
+	s := &t.versions
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readers == nil {
+		s.readers = make(map[uint64]int)
+	}
+	s.readers[s.current]++
+
+	return &Reader[T]{
+		tree:    t,
+		version: s.current,
+	}, nil
+}
+
+// Version returns the version the reader reads the tree at
+func (r *Reader[T]) Version() uint64 {
+	return r.version
+}
+
+// FindPoint returns the record stored under the key as of the reader's version, or ErrNotFound if there was none
+func (r *Reader[T]) FindPoint(val T) (Record[T], error) {
+	r.checkOpen()
+	return r.tree.FindPoint(val, AsOf(r.version))
+}
+
+// FindRange iterates over the records that satisfied low <= x < high as of the reader's version
+func (r *Reader[T]) FindRange(low T, high T) Iterator[T] {
+	r.checkOpen()
+	return r.tree.FindRange(low, high, AsOf(r.version))
+}
+
+// Close lets the versions only the reader could see be garbage collected
+// The reader cannot be used after it is closed, and neither can the iterators from it once the tree is garbage collected
+func (r *Reader[T]) Close() {
+	if !r.closed.CompareAndSwap(false, true) {
+		return
+	}
+
+	s := &r.tree.versions
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.readers[r.version]--
+	if s.readers[r.version] == 0 {
+		delete(s.readers, r.version)
+	}
+}
+
+func (r *Reader[T]) checkOpen() {
+	if r.closed.Load() {
+		panic("Reader is closed")
+	}
+}
+
+// GC prunes the versions that neither the latest version nor any open reader can see anymore,
+// and removes the keys that were deleted before all of them
+// It returns how many versions were pruned
+func (t *Tree[T]) GC() int {
+	_, unlock := t.lockTree(latchNone)
+	defer unlock()
+
+	if !t.versioned || t.root == nil {
+		return 0
+	}
+	defer t.validateChange("GC")()
+
+	s := &t.versions
+	oldest := s.current
+	s.mu.Lock()
+	for version := range s.readers {
+		oldest = min(oldest, version)
+	}
+	s.mu.Unlock()
+
+	// start from the left most leaf
+	leaf := t.root
+	for !leaf.isLeaf {
+		leaf = leaf.pointers[0].(*node[T])
+	}
+
+	pruned := 0
+	removed := make([]T, 0)
+	for leaf != nil {
+		for i := range leaf.numKeys {
+			head, ok := leaf.pointers[i].(*recordVersion[T])
+			if !ok {
+				continue
+			}
+
+			kept, count := pruneVersions(head, oldest)
+			pruned += count
+			if kept == nil {
+				removed = append(removed, leaf.keys[i])
+			} else if count > 0 {
+				leaf = t.unshare(leaf)
+				leaf.pointers[i] = kept
+				t.markDirty(leaf)
+			}
+		}
+
+		next, _ := leaf.pointers[t.maxLeafPointers].(*node[T])
+		leaf = next
+	}
+
+	// deleting rebalances the tree, so it waits until the leaves have been walked
+	for _, val := range removed {
+		leaf, idx, _ := t.findFirst(val, latchNone)
+		t.deleteFromLeaf(t.unshare(leaf), idx)
+	}
+
+	s.horizon = oldest
+	return pruned
+}
+
+// the versions that a reader at the oldest version or later can still see, and how many were pruned
+// the versions are copied rather than cut off, since snapshots can share them
+// if there are none left, the key was deleted before the oldest version and can be removed
+func pruneVersions[T cmp.Ordered](head *recordVersion[T], oldest uint64) (*recordVersion[T], int) {
+	// the newer versions, and the one that was current at the oldest version
+	kept := make([]*recordVersion[T], 0)
+	total := 0
+	for v := head; v != nil; v = v.older {
+		if len(kept) == 0 || kept[len(kept)-1].version > oldest {
+			kept = append(kept, v)
+		}
+		total++
+	}
+
+	// a key that was deleted as of the oldest version reads the same as one that was never there
+	if last := kept[len(kept)-1]; last.version <= oldest && last.record == nil {
+		kept = kept[:len(kept)-1]
+	}
+	if len(kept) == total {
+		return head, 0
+	}
+
+	var pruned *recordVersion[T]
+	for i := len(kept) - 1; i >= 0; i-- {
+		pruned = &recordVersion[T]{
+			version: kept[i].version,
+			record:  kept[i].record,
+			older:   pruned,
+		}
+	}
+	return pruned, total - len(kept)
+}
@@ -0,0 +1,238 @@
+package bptree
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// the labels in a map of keys to labels, in key order
+func sortedLabels(contents map[int]string) []string {
+	labels := make([]string, 0, len(contents))
+	for _, key := range slices.Sorted(maps.Keys(contents)) {
+		labels = append(labels, contents[key])
+	}
+	return labels
+}
+
+// make random changes to a versioned tree, and add what it held after each of them to what it held at every version before
+func randomVersionedChanges(tree *Tree[int], r *rand.Rand, history []map[int]string, changes int) []map[int]string {
+	contents := maps.Clone(history[len(history)-1])
+
+	for target := len(history) + changes; len(history) < target; {
+		val := r.Intn(100)
+		before := tree.Version()
+		label := fmt.Sprint(before + 1)
+
+		var changed bool
+		switch r.Intn(3) {
+		case 0:
+			changed = tree.Delete(val) == nil
+			delete(contents, val)
+		case 1:
+			changed = tree.Insert(&labelledRecord{val, label}) == nil
+			if changed {
+				contents[val] = label
+			}
+		default:
+			tree.Upsert(&labelledRecord{val, label})
+			changed = true
+			contents[val] = label
+		}
+
+		if changed {
+			history = append(history, maps.Clone(contents))
+			if tree.Version() != before+1 {
+				panic(fmt.Sprintf("Expected version %d after a change, got %d", before+1, tree.Version()))
+			}
+		} else if tree.Version() != before {
+			panic(fmt.Sprintf("Expected version %d to stay the same without a change, got %d", before, tree.Version()))
+		}
+	}
+
+	return history
+}
+
+func TestVersionedReadsAsOf(t *testing.T) {
+	for _, order := range []int{3, 4, 8} {
+		t.Run(fmt.Sprintf("order %d", order), func(t *testing.T) {
+			tree := NewTree[int](WithOrder(order), WithVersions())
+			history := randomVersionedChanges(tree, rand.New(rand.NewSource(int64(order))), []map[int]string{{}}, 1000)
+
+			for version, contents := range history {
+				if labels := collectLabels(tree.FindRange(0, 100, AsOf(uint64(version)))); !slices.Equal(labels, sortedLabels(contents)) {
+					t.Fatalf("Contents as of version %d did not match:\nExpected: %v\nGot: %v", version, sortedLabels(contents), labels)
+				}
+
+				for val := range 100 {
+					record, _ := tree.FindPoint(val, AsOf(uint64(version)))
+					if label, ok := contents[val]; ok != (record != nil) || (ok && record.String() != label) {
+						t.Fatalf("FindPoint of %d as of version %d returned %v, expected %q", val, version, record, label)
+					}
+				}
+			}
+
+			latest := history[len(history)-1]
+			if labels := collectLabels(tree.FindRange(0, 100)); !slices.Equal(labels, sortedLabels(latest)) {
+				t.Errorf("Latest contents did not match:\nExpected: %v\nGot: %v", sortedLabels(latest), labels)
+			}
+		})
+	}
+}
+
+func TestVersionedGCKeepsWhatReadersCanSee(t *testing.T) {
+	tree := NewTree[int](WithOrder(4), WithVersions())
+	r := rand.New(rand.NewSource(1))
+	history := randomVersionedChanges(tree, r, []map[int]string{{}}, 300)
+
+	reader, err := tree.OpenReader()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reader.Version() != 300 {
+		t.Fatalf("Expected the reader to be at version 300, got %d", reader.Version())
+	}
+	history = randomVersionedChanges(tree, r, history, 300)
+
+	if pruned := tree.GC(); pruned == 0 {
+		t.Errorf("Expected versions before the reader to be pruned")
+	}
+	if labels := collectLabels(reader.FindRange(0, 100)); !slices.Equal(labels, sortedLabels(history[300])) {
+		t.Errorf("Reader did not see its version after GC:\nExpected: %v\nGot: %v", sortedLabels(history[300]), labels)
+	}
+	for version := 300; version < len(history); version++ {
+		if labels := collectLabels(tree.FindRange(0, 100, AsOf(uint64(version)))); !slices.Equal(labels, sortedLabels(history[version])) {
+			t.Errorf("Contents as of version %d did not match after GC:\nExpected: %v\nGot: %v", version, sortedLabels(history[version]), labels)
+		}
+	}
+
+	if _, err := tree.FindPoint(1, AsOf(299)); !errors.Is(err, ErrVersionGone) {
+		t.Errorf("Expected ErrVersionGone for a collected version, got %v", err)
+	}
+	if _, err := tree.Floor(1, AsOf(299)); !errors.Is(err, ErrVersionGone) {
+		t.Errorf("Expected ErrVersionGone for a collected version, got %v", err)
+	}
+
+	// once the reader is gone, only the latest version is left, and deleted keys leave the leaves
+	reader.Close()
+	tree.GC()
+
+	latest := history[len(history)-1]
+	if labels := collectLabels(tree.FindRange(0, 100)); !slices.Equal(labels, sortedLabels(latest)) {
+		t.Errorf("Latest contents did not match after GC:\nExpected: %v\nGot: %v", sortedLabels(latest), labels)
+	}
+	if keys := leafKeys(tree.root); !slices.Equal(keys, slices.Sorted(maps.Keys(latest))) {
+		t.Errorf("Expected only the keys that are still there in the leaves:\nExpected: %v\nGot: %v", slices.Sorted(maps.Keys(latest)), keys)
+	}
+	if tree.GC() != 0 {
+		t.Errorf("Expected nothing left to prune")
+	}
+	checkParents(t, tree.root)
+}
+
+func TestVersionedSnapshotSurvivesGC(t *testing.T) {
+	tree := NewTree[int](WithOrder(3), WithVersions())
+	for val := range 50 {
+		tree.Insert(NewIntRecord(val))
+	}
+
+	snapshot := tree.Snapshot()
+	defer snapshot.Close()
+	for val := range 50 {
+		tree.Delete(val)
+	}
+	tree.GC()
+
+	if keys := collectKeys(snapshot.FindRange(0, 50)); len(keys) != 50 {
+		t.Errorf("Expected the snapshot to keep every key, got %v", keys)
+	}
+	if keys := leafKeys(tree.root); len(keys) != 0 {
+		t.Errorf("Expected the tree to be empty after GC, got %v", keys)
+	}
+}
+
+func TestVersionedConcurrentReaders(t *testing.T) {
+	tree := NewTree[int](WithOrder(4), WithVersions())
+	for val := range 200 {
+		tree.Insert(NewIntRecord(val))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r := rand.New(rand.NewSource(1))
+		for i := range 2000 {
+			if val := r.Intn(200); r.Intn(2) == 0 {
+				tree.Delete(val)
+			} else {
+				tree.Insert(NewIntRecord(val))
+			}
+			if i%100 == 0 {
+				tree.GC()
+			}
+		}
+	}()
+
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				reader, err := tree.OpenReader()
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+					return
+				}
+				first := collectKeys(reader.FindRange(0, 200))
+				if second := collectKeys(reader.FindRange(0, 200)); !slices.Equal(first, second) {
+					t.Errorf("Reader at version %d saw the tree change:\n%v\n%v", reader.Version(), first, second)
+				}
+				reader.Close()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestUnversionedTreeCannotBeReadAsOf(t *testing.T) {
+	tree := NewTree[int]()
+	tree.Insert(NewIntRecord(1))
+
+	if _, err := tree.FindPoint(1, AsOf(0)); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported from FindPoint, got %v", err)
+	}
+	if _, err := tree.Floor(1, AsOf(0)); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported from Floor, got %v", err)
+	}
+	if records := tree.Scan(KeyRange[int]{}, AsOf(0)); records.Next() != nil || !errors.Is(records.Err(), ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported from the iterator, got %v", records.Err())
+	}
+	if c := tree.Cursor(AsOf(0)); c.First() || !errors.Is(c.Err(), ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported from the cursor, got %v", c.Err())
+	}
+	if _, err := tree.OpenReader(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported from OpenReader, got %v", err)
+	}
+}
+
+// every key in the leaves, including keys that were deleted but not yet collected
+func leafKeys(n *node[int]) []int {
+	if n == nil {
+		return []int{}
+	}
+	for !n.isLeaf {
+		n = n.pointers[0].(*node[int])
+	}
+
+	keys := make([]int, 0)
+	for n != nil {
+		keys = append(keys, n.keys[:n.numKeys]...)
+		n, _ = n.pointers[len(n.pointers)-1].(*node[int])
+	}
+	return keys
+}
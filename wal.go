@@ -0,0 +1,243 @@
+package bptree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// how large the log is allowed to grow before its pages are written to the tree's file
+	DEFAULT_CHECKPOINT_SIZE = 4 << 20
+
+	// body length and checksum, at the start of every log record
+	WAL_RECORD_HEADER_SIZE = 8
+)
+
+// WithWAL makes every change to a tree opened with Open durable as soon as the call making it returns
+//
+// Before a change is applied to the tree's file, every page it touched, including the pages of any splits or merges,
+// is appended to a write-ahead log next to the file and synced
+// When the tree is opened again, the log is replayed into the file, so a crash part of the way through writing
+// the file can never leave a torn tree behind, and changes that did not make it into the log are dropped as a whole
+func WithWAL() TreeOption {
+	return func(o *treeOptions) {
+		o.wal = true
+	}
+}
+
+// WithCheckpointSize sets how many bytes the write-ahead log can grow to before it is written into the tree's file
+func WithCheckpointSize(size int64) TreeOption {
+	return func(o *treeOptions) {
+		o.checkpointSize = size
+	}
+}
+
+// the full contents of a page, ready to be written to the tree's file
+type pageImage struct {
+	pageID uint64
+	data   []byte
+}
+
+// the log that sits next to a tree's file
+// each record is every page that a single operation changed, and is laid out as
+//
+//	body length (4 bytes) | checksum of the body (4 bytes) | number of pages | (page id | page length | page) ...
+//
+// a record only counts once it has been synced, so a torn record at the end of the log is ignored
+type writeAheadLog struct {
+	file File
+	size int64
+}
+
+func walPath(path string) string {
+	return path + "-wal"
+}
+
+// append a record with the pages and sync it, so that the change is durable once this returns
+func (w *writeAheadLog) append(images []pageImage) error {
+	record := make([]byte, WAL_RECORD_HEADER_SIZE)
+	record = binary.AppendUvarint(record, uint64(len(images)))
+	for _, image := range images {
+		record = binary.AppendUvarint(record, image.pageID)
+		record = appendBytes(record, image.data)
+	}
+
+	body := record[WAL_RECORD_HEADER_SIZE:]
+	binary.LittleEndian.PutUint32(record, uint32(len(body)))
+	binary.LittleEndian.PutUint32(record[4:], crc32.ChecksumIEEE(body))
+
+	if _, err := w.file.WriteAt(record, w.size); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+
+	w.size += int64(len(record))
+	return nil
+}
+
+// empty the log once everything in it has made it into the tree's file
+func (w *writeAheadLog) reset() error {
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+
+	w.size = 0
+	return nil
+}
+
+// write every complete record in the log into the tree's file, and empty the log
+// records are replayed in order, so the file ends up with the latest image of every page
+func (w *writeAheadLog) replay(file File) error {
+	size, err := w.file.Size()
+	if err != nil {
+		return err
+	}
+	w.size = size
+	if size == 0 {
+		return nil
+	}
+
+	replayed := false
+	for offset := int64(0); offset+WAL_RECORD_HEADER_SIZE <= size; {
+		header := make([]byte, WAL_RECORD_HEADER_SIZE)
+		if _, err := w.file.ReadAt(header, offset); err != nil {
+			return err
+		}
+
+		bodyLength := int64(binary.LittleEndian.Uint32(header))
+		if offset+WAL_RECORD_HEADER_SIZE+bodyLength > size {
+			// the crash happened part of the way through appending this record
+			break
+		}
+
+		body := make([]byte, bodyLength)
+		if _, err := w.file.ReadAt(body, offset+WAL_RECORD_HEADER_SIZE); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if binary.LittleEndian.Uint32(header[4:]) != crc32.ChecksumIEEE(body) {
+			break
+		}
+
+		images, err := decodeWALRecord(body)
+		if err != nil {
+			return err
+		}
+		for _, image := range images {
+			if _, err := file.WriteAt(image.data, int64(image.pageID)*int64(len(image.data))); err != nil {
+				return err
+			}
+		}
+
+		replayed = true
+		offset += WAL_RECORD_HEADER_SIZE + bodyLength
+	}
+
+	if replayed {
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+	return w.reset()
+}
+
+func decodeWALRecord(body []byte) ([]pageImage, error) {
+	r := &pageReader{page: body}
+
+	count := r.uvarint()
+	if r.err != nil || count > uint64(len(body)) {
+		return nil, fmt.Errorf("%w: bad log record", ErrCorruptPage)
+	}
+
+	images := make([]pageImage, 0, count)
+	for range count {
+		image := pageImage{
+			pageID: r.uvarint(),
+			data:   r.bytes(),
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("%w: bad log record: %v", ErrCorruptPage, r.err)
+		}
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// make the changes of the operation that just finished durable, by appending them to the log
+// once the log has grown large enough, it is written into the tree's file
+// an error means the change is in memory but is not durable, and the tree refuses any further change
+func (t *Tree[T]) commit() error {
+	s := t.store
+	if s == nil {
+		return nil
+	}
+	// the operation is over either way, so the nodes it pinned can be evicted again
+	defer t.release()
+
+	if s.wal == nil || s.err != nil {
+		return s.err
+	}
+	// lookups and rejected changes have nothing to log
+	if len(s.dirty) == 0 && len(s.freePending) == 0 && !s.metaDirty {
+		return nil
+	}
+
+	images, err := s.collectChanges(t)
+	if err == nil {
+		err = s.wal.append(images)
+	}
+	if err == nil {
+		for _, image := range images {
+			s.unwritten[image.pageID] = image.data
+		}
+		if s.wal.size >= s.checkpointSize {
+			err = s.checkpoint()
+		}
+	}
+
+	// the change is in memory but is not durable, so the tree cannot be trusted to match its file anymore
+	if err != nil {
+		s.err = fmt.Errorf("bptree: tree was not committed, reopen it to recover: %w", err)
+		return s.err
+	}
+	return nil
+}
+
+// deferred by every change, to commit it and report a failure to commit as the change's own error,
+// unless the change already failed for another reason
+func (t *Tree[T]) commitInto(err *error) {
+	if commitErr := t.commit(); *err == nil {
+		*err = commitErr
+	}
+}
+
+// write every page in the log into the tree's file, after which the log can be emptied
+func (s *pageStore[T]) checkpoint() error {
+	if len(s.unwritten) == 0 {
+		return nil
+	}
+
+	for pageID, data := range s.unwritten {
+		if _, err := s.file.WriteAt(data, int64(pageID)*int64(s.pageSize)); err != nil {
+			return err
+		}
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	// only empty the log once the file is synced, since the log is all there is to recover from until then
+	if err := s.wal.reset(); err != nil {
+		return err
+	}
+	clear(s.unwritten)
+	return nil
+}
@@ -0,0 +1,310 @@
+package bptree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"testing"
+)
+
+var errInjected = errors.New("injected fault")
+
+// an in memory file system that keeps track of what has been synced, and can fail every write from a given point on
+// Writes, truncates and syncs are all write points
+type faultFS struct {
+	files map[string]*faultFile
+
+	writePoints int
+	// the write point that fails, along with every one after it, 0 to never fail
+	failAt  int
+	crashed bool
+}
+
+type faultFile struct {
+	fs *faultFS
+
+	// what reads see
+	data []byte
+	// what is guaranteed to survive a crash
+	synced []byte
+	// changes since the last sync, which may or may not survive a crash
+	unsynced []faultWrite
+}
+
+// a write, or a truncate if data is nil
+type faultWrite struct {
+	offset int64
+	data   []byte
+}
+
+func newFaultFS() *faultFS {
+	return &faultFS{
+		files: make(map[string]*faultFile),
+	}
+}
+
+func (fs *faultFS) OpenFile(name string, create bool) (File, error) {
+	file, ok := fs.files[name]
+	if !ok {
+		if !create {
+			return nil, fmt.Errorf("open %s: %w", name, os.ErrNotExist)
+		}
+		file = &faultFile{}
+		fs.files[name] = file
+	}
+
+	file.fs = fs
+	return file, nil
+}
+
+func (fs *faultFS) writePoint() error {
+	fs.writePoints++
+	if fs.failAt != 0 && fs.writePoints >= fs.failAt {
+		fs.crashed = true
+		return errInjected
+	}
+	return nil
+}
+
+// the file system as it could be after a power loss at the fault
+// each change that was not synced survives or not at random, and writes can be torn part of the way through
+func (fs *faultFS) crash(r *rand.Rand) *faultFS {
+	crashed := newFaultFS()
+	for name, file := range fs.files {
+		data := slices.Clone(file.synced)
+		for _, change := range file.unsynced {
+			if r.Intn(2) == 0 {
+				continue
+			}
+
+			if change.data == nil {
+				data = data[:min(int64(len(data)), change.offset)]
+				continue
+			}
+
+			torn := change.data
+			if r.Intn(2) == 0 {
+				torn = torn[:r.Intn(len(torn)+1)]
+			}
+			data = writeAt(data, torn, change.offset)
+		}
+
+		crashed.files[name] = &faultFile{
+			data:   data,
+			synced: slices.Clone(data),
+		}
+	}
+
+	return crashed
+}
+
+func writeAt(data []byte, p []byte, offset int64) []byte {
+	if end := offset + int64(len(p)); end > int64(len(data)) {
+		data = append(data, make([]byte, end-int64(len(data)))...)
+	}
+	copy(data[offset:], p)
+	return data
+}
+
+func (f *faultFile) ReadAt(p []byte, offset int64) (int, error) {
+	if offset >= int64(len(f.data)) {
+		return 0, errors.New("read past the end of the file")
+	}
+
+	n := copy(p, f.data[offset:])
+	if n < len(p) {
+		return n, errors.New("short read")
+	}
+	return n, nil
+}
+
+func (f *faultFile) WriteAt(p []byte, offset int64) (int, error) {
+	err := f.fs.writePoint()
+
+	// the write that faults can still partly make it to the disk
+	f.unsynced = append(f.unsynced, faultWrite{offset, slices.Clone(p)})
+	if err != nil {
+		return 0, err
+	}
+
+	f.data = writeAt(f.data, p, offset)
+	return len(p), nil
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	if err := f.fs.writePoint(); err != nil {
+		return err
+	}
+
+	f.unsynced = append(f.unsynced, faultWrite{offset: size})
+	f.data = f.data[:min(int64(len(f.data)), size)]
+	return nil
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.fs.writePoint(); err != nil {
+		return err
+	}
+
+	f.synced = slices.Clone(f.data)
+	f.unsynced = nil
+	return nil
+}
+
+func (f *faultFile) Size() (int64, error) {
+	return int64(len(f.data)), nil
+}
+
+func (f *faultFile) Close() error {
+	return nil
+}
+
+func treeKeys(tree *Tree[int]) []int {
+	if tree.root == nil {
+		return []int{}
+	}
+	return collectKeys(tree.FindRange(-1, 1<<30))
+}
+
+func TestWALRecoversFromCrashAtEveryWritePoint(t *testing.T) {
+	type operation struct {
+		insert bool
+		val    int
+	}
+
+	// the first operation has to be an insert, since the tree starts off empty
+	r := rand.New(rand.NewSource(1))
+	operations := []operation{{true, 20}}
+	for range 80 {
+		operations = append(operations, operation{r.Intn(3) != 0, r.Intn(40)})
+	}
+
+	// the tree's contents after each number of operations
+	expectedAfter := [][]int{{}}
+	expected := make(map[int]bool)
+	for _, op := range operations {
+		if op.insert {
+			expected[op.val] = true
+		} else {
+			delete(expected, op.val)
+		}
+
+		keys := make([]int, 0, len(expected))
+		for val := range expected {
+			keys = append(keys, val)
+		}
+		slices.Sort(keys)
+		expectedAfter = append(expectedAfter, keys)
+	}
+
+	opts := []TreeOption{WithWAL(), WithPageSize(128), WithCheckpointSize(1024), WithMemoryBudget(4 * 128)}
+
+	for failAt := 1; ; failAt++ {
+		fs := newFaultFS()
+		fs.failAt = failAt
+
+		// operations only count as done once they are acknowledged without an error
+		acknowledged := 0
+		tree, err := Open[int]("tree.db", IntRecordCodec{}, append(opts, WithFS(fs))...)
+		if err == nil {
+			for _, op := range operations {
+				if op.insert {
+					err = tree.Insert(NewIntRecord(op.val))
+				} else {
+					err = tree.Delete(op.val)
+				}
+
+				// inserting a key that is there already, or deleting one that is not, changes nothing
+				if err != nil && !errors.Is(err, ErrDuplicate) && !errors.Is(err, ErrNotFound) {
+					break
+				}
+				acknowledged++
+			}
+			tree.Close()
+		}
+
+		if !fs.crashed {
+			if acknowledged != len(operations) {
+				t.Fatalf("Expected every operation to go through without faults, got %d", acknowledged)
+			}
+			break
+		}
+
+		for seed := range 3 {
+			crashed := fs.crash(rand.New(rand.NewSource(int64(seed))))
+
+			recovered, err := Open[int]("tree.db", IntRecordCodec{}, append(opts, WithFS(crashed))...)
+			if err != nil {
+				t.Fatalf("Fault at write %d, seed %d: could not recover: %v", failAt, seed, err)
+			}
+
+			// the operation in flight at the crash may or may not have made it into the log
+			keys := treeKeys(recovered)
+			if !slices.Equal(keys, expectedAfter[acknowledged]) && (acknowledged == len(operations) || !slices.Equal(keys, expectedAfter[acknowledged+1])) {
+				t.Fatalf("Fault at write %d, seed %d: recovered the wrong contents after %d operations:\nExpected: %v\nGot: %v", failAt, seed, acknowledged, expectedAfter[acknowledged], keys)
+			}
+
+			// the recovered tree should be fully usable, and survive being reopened
+			for val := range 40 {
+				recovered.Insert(NewIntRecord(val))
+			}
+			if err := recovered.Close(); err != nil {
+				t.Fatalf("Fault at write %d, seed %d: unexpected error on close: %v", failAt, seed, err)
+			}
+
+			reopened, err := Open[int]("tree.db", IntRecordCodec{}, append(opts, WithFS(crashed))...)
+			if err != nil {
+				t.Fatalf("Fault at write %d, seed %d: could not reopen: %v", failAt, seed, err)
+			}
+			if keys := treeKeys(reopened); len(keys) != 40 {
+				t.Fatalf("Fault at write %d, seed %d: expected 40 keys after reopening, got %v", failAt, seed, keys)
+			}
+		}
+	}
+}
+
+func TestWALRefusesChangesAfterAFault(t *testing.T) {
+	fs := newFaultFS()
+	tree, err := Open[int]("tree.db", IntRecordCodec{}, WithFS(fs), WithWAL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tree.Insert(NewIntRecord(1))
+	fs.failAt = fs.writePoints + 1
+	if err := tree.Insert(NewIntRecord(2)); !errors.Is(err, errInjected) {
+		t.Fatalf("Expected the insert to return the injected fault, got %v", err)
+	}
+
+	if !errors.Is(tree.Err(), errInjected) {
+		t.Fatalf("Expected the injected fault, got %v", tree.Err())
+	}
+	if err := tree.Insert(NewIntRecord(3)); !errors.Is(err, errInjected) {
+		t.Errorf("Expected the tree to refuse changes after a fault, got %v", err)
+	}
+	if err := tree.Close(); !errors.Is(err, errInjected) {
+		t.Errorf("Expected close to return the injected fault, got %v", err)
+	}
+}
+
+func TestWALIsReplayedWithoutIt(t *testing.T) {
+	fs := newFaultFS()
+	tree, err := Open[int]("tree.db", IntRecordCodec{}, WithFS(fs), WithWAL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := range 10 {
+		tree.Insert(NewIntRecord(i))
+	}
+
+	// without closing, the changes are only in the log
+	reopened, err := Open[int]("tree.db", IntRecordCodec{}, WithFS(fs))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if keys := treeKeys(reopened); len(keys) != 10 {
+		t.Errorf("Expected the log to be replayed, got %v", keys)
+	}
+}